@@ -0,0 +1,656 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+)
+
+// snapshotCollections hold the blog data, in restore order. Derived and
+// transient collections (views, outbox, webhook deliveries, quotas) are left
+// out. Collections that don't exist are skipped.
+var snapshotCollections = []string{
+	"schema_migrations",
+	"tenants",
+	"blog",
+	"blog_reactions",
+	"audit_events",
+	"attachments.files",
+	"attachments.chunks",
+}
+
+const (
+	manifestName = "manifest.json"
+	// formatVersion is bumped on incompatible changes of the archive layout.
+	formatVersion = 1
+	// restoreBatchSize is the number of documents inserted at once.
+	restoreBatchSize = 500
+	// maxDocumentSize is the largest BSON document accepted by the server.
+	maxDocumentSize = 16 << 20
+)
+
+// manifest describes the content of a snapshot. It is the last entry of the
+// archive.
+type manifest struct {
+	FormatVersion int       `json:"format_version"`
+	Database      string    `json:"database"`
+	CreatedAt     time.Time `json:"created_at"`
+	// Consistent tells whether every collection was read at the same point
+	// in time, which needs a replica set or a sharded cluster
+	Consistent  bool                 `json:"consistent"`
+	Collections []manifestCollection `json:"collections"`
+}
+
+type manifestCollection struct {
+	Name          string `json:"name"`
+	Documents     int64  `json:"documents"`
+	DataSHA256    string `json:"data_sha256"`
+	Indexes       int64  `json:"indexes"`
+	IndexesSHA256 string `json:"indexes_sha256"`
+}
+
+// dataEntry and indexesEntry are the archive entries of a collection, both
+// holding concatenated BSON documents like mongodump.
+func dataEntry(collection string) string    { return "data/" + collection + ".bson" }
+func indexesEntry(collection string) string { return "indexes/" + collection + ".bson" }
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	uri := flag.String("mongo-uri", "mongodb://localhost:27017", "URI of the MongoDB deployment")
+	dbName := flag.String("db", "mydb", "name of the blog database")
+	consistent := flag.Bool("consistent", true, "read every collection at the same point in time when the deployment supports it, the snapshot must then be taken within the transactionLifetimeLimitSeconds of the server (60s by default)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] snapshot|restore|verify <file.tar.gz>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	command, path := flag.Arg(0), flag.Arg(1)
+
+	if command == "verify" {
+		m, err := verify(path)
+		if err != nil {
+			log.Fatalf("Snapshot is invalid: %v\n", err)
+		}
+		printManifest(m)
+		fmt.Println("Snapshot is valid")
+		return
+	}
+	if command != "snapshot" && command != "restore" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	client, err := mongo.NewClient(options.Client().ApplyURI(*uri))
+	if err != nil {
+		log.Fatalf("Failed creating database client: %v\n", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		log.Fatalf("Failed connecting to database: %v\n", err)
+	}
+	defer client.Disconnect(ctx)
+	db := client.Database(*dbName)
+
+	switch command {
+	case "snapshot":
+		m, err := snapshot(ctx, db, path, *consistent)
+		if err != nil {
+			log.Fatalf("Failed taking snapshot: %v\n", err)
+		}
+		printManifest(m)
+		if !m.Consistent && *consistent {
+			fmt.Println("Warning: the deployment doesn't support transactions, collections were read one after the other")
+		}
+		fmt.Printf("Snapshot written to %s\n", path)
+	case "restore":
+		m, err := restore(ctx, db, path)
+		if err != nil {
+			log.Fatalf("Failed restoring snapshot: %v\n", err)
+		}
+		printManifest(m)
+		fmt.Printf("Snapshot restored into %s\n", *dbName)
+	}
+}
+
+func printManifest(m *manifest) {
+	fmt.Printf("Snapshot of %s taken at %s\n", m.Database, m.CreatedAt.Format(time.RFC3339))
+	for _, c := range m.Collections {
+		fmt.Printf("  %-20s %8d documents %3d indexes\n", c.Name, c.Documents, c.Indexes)
+	}
+}
+
+// supportsTransactions asks the server whether it is a replica set or a
+// sharded cluster, the only deployments supporting snapshot reads.
+func supportsTransactions(ctx context.Context, db *mongo.Database) (bool, error) {
+	var res struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := db.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&res); err != nil {
+		return false, err
+	}
+	return res.SetName != "" || res.Msg == "isdbgrid", nil
+}
+
+// isTransactionExpired reports whether err comes from the server aborting a
+// transaction for exceeding its lifetime limit.
+func isTransactionExpired(err error) bool {
+	const (
+		noSuchTransaction                       = 251
+		transactionExceededLifetimeLimitSeconds = 290
+	)
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+	return cmdErr.Code == noSuchTransaction || cmdErr.Code == transactionExceededLifetimeLimitSeconds
+}
+
+// snapshotFile is a collection dumped to a temporary file before being
+// archived, tar needing the size of every entry upfront.
+type snapshotFile struct {
+	Entry string
+	Path  string
+}
+
+// snapshot writes an archive of the blog collections to path, and its
+// checksum to path.sha256. When consistent, the collections are read in a
+// single snapshot transaction if the deployment supports it. The server
+// aborts transactions older than its transactionLifetimeLimitSeconds, which
+// bounds the size of a consistent snapshot; larger databases need the limit
+// raised, or an inconsistent snapshot.
+func snapshot(ctx context.Context, db *mongo.Database, path string, consistent bool) (*manifest, error) {
+	names, err := db.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("listing collections: %v", err)
+	}
+	existing := make(map[string]bool, len(names))
+	for _, n := range names {
+		existing[n] = true
+	}
+
+	if consistent {
+		if consistent, err = supportsTransactions(ctx, db); err != nil {
+			return nil, fmt.Errorf("inspecting database: %v", err)
+		}
+	}
+
+	tmp, err := ioutil.TempDir("", "blog-snapshot")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	m := &manifest{
+		FormatVersion: formatVersion,
+		Database:      db.Name(),
+		CreatedAt:     time.Now().UTC(),
+		Consistent:    consistent,
+	}
+	var files []snapshotFile
+
+	// Index definitions can't be read in a transaction, they don't need to
+	// be consistent with the documents anyway
+	for _, name := range snapshotCollections {
+		if !existing[name] {
+			continue
+		}
+		c := manifestCollection{Name: name}
+		file := filepath.Join(tmp, fmt.Sprintf("%d.indexes", len(files)))
+		c.Indexes, c.IndexesSHA256, err = dumpFile(file, func(w io.Writer) (int64, error) {
+			return dumpIndexes(ctx, db.Collection(name), w)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("dumping indexes of %s: %v", name, err)
+		}
+		m.Collections = append(m.Collections, c)
+		files = append(files, snapshotFile{Entry: indexesEntry(name), Path: file})
+	}
+
+	dumpAll := func(ctx context.Context) error {
+		for i := range m.Collections {
+			c := &m.Collections[i]
+			file := filepath.Join(tmp, fmt.Sprintf("%d.data", i))
+			var err error
+			c.Documents, c.DataSHA256, err = dumpFile(file, func(w io.Writer) (int64, error) {
+				return dumpDocuments(ctx, db.Collection(c.Name), w)
+			})
+			if err != nil {
+				return fmt.Errorf("dumping %s: %v", c.Name, err)
+			}
+			files = append(files, snapshotFile{Entry: dataEntry(c.Name), Path: file})
+		}
+		return nil
+	}
+	if consistent {
+		// Read every collection at the same point in time. The transaction
+		// only reads, so it is aborted once done.
+		err = db.Client().UseSession(ctx, func(sc mongo.SessionContext) error {
+			err := sc.StartTransaction(options.Transaction().SetReadConcern(readconcern.Snapshot()))
+			if err != nil {
+				return err
+			}
+			defer sc.AbortTransaction(context.Background())
+			return dumpAll(sc)
+		})
+		if isTransactionExpired(err) {
+			return nil, fmt.Errorf("%v: the snapshot outlived the transactionLifetimeLimitSeconds of the server, raise it or use -consistent=false", err)
+		}
+	} else {
+		err = dumpAll(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeArchive(path, files, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// dumpFile writes the output of dump to file, returning its count and the
+// checksum of what was written.
+func dumpFile(file string, dump func(w io.Writer) (int64, error)) (int64, string, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	buf := bufio.NewWriter(io.MultiWriter(f, hasher))
+	n, err := dump(buf)
+	if err != nil {
+		return 0, "", err
+	}
+	if err := buf.Flush(); err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(hasher.Sum(nil)), f.Close()
+}
+
+func dumpDocuments(ctx context.Context, collection *mongo.Collection, w io.Writer) (int64, error) {
+	cursor, err := collection.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var n int64
+	for cursor.Next(ctx) {
+		if _, err := w.Write(cursor.Current); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, cursor.Err()
+}
+
+func dumpIndexes(ctx context.Context, collection *mongo.Collection, w io.Writer) (int64, error) {
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var n int64
+	for cursor.Next(ctx) {
+		if _, err := w.Write(cursor.Current); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, cursor.Err()
+}
+
+// writeArchive writes the gzipped tar of the files followed by the manifest,
+// then the checksum of the archive in the format of sha256sum.
+func writeArchive(path string, files []snapshotFile, m *manifest) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(f, hasher))
+	tw := tar.NewWriter(gz)
+
+	for _, file := range files {
+		if err := addFile(tw, file, m.CreatedAt); err != nil {
+			return fmt.Errorf("archiving %s: %v", file.Entry, err)
+		}
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := addEntry(tw, manifestName, int64(len(data)), m.CreatedAt, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("archiving manifest: %v", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	sum := fmt.Sprintf("%s  %s\n", hex.EncodeToString(hasher.Sum(nil)), filepath.Base(path))
+	return ioutil.WriteFile(path+".sha256", []byte(sum), 0644)
+}
+
+func addFile(tw *tar.Writer, file snapshotFile, modTime time.Time) error {
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return addEntry(tw, file.Entry, info.Size(), modTime, f)
+}
+
+func addEntry(tw *tar.Writer, name string, size int64, modTime time.Time, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, r)
+	return err
+}
+
+// readDocuments calls fn with every BSON document of r, validating them.
+func readDocuments(r io.Reader, fn func(doc bson.Raw) error) (int64, error) {
+	var n int64
+	var size [4]byte
+	for {
+		if _, err := io.ReadFull(r, size[:]); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("document %d: %v", n, err)
+		}
+
+		length := binary.LittleEndian.Uint32(size[:])
+		if length < 5 || length > maxDocumentSize {
+			return n, fmt.Errorf("document %d: invalid length %d", n, length)
+		}
+		doc := make([]byte, length)
+		copy(doc, size[:])
+		if _, err := io.ReadFull(r, doc[4:]); err != nil {
+			return n, fmt.Errorf("document %d: %v", n, err)
+		}
+		if err := bson.Raw(doc).Validate(); err != nil {
+			return n, fmt.Errorf("document %d: %v", n, err)
+		}
+
+		if err := fn(doc); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// walkArchive calls fn with every entry of the archive.
+func walkArchive(path string, fn func(name string, r io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(header.Name, tr); err != nil {
+			return fmt.Errorf("%s: %v", header.Name, err)
+		}
+	}
+}
+
+// verifyChecksumFile compares the archive with the checksum written next to
+// it, if any.
+func verifyChecksumFile(path string) error {
+	data, err := ioutil.ReadFile(path + ".sha256")
+	if os.IsNotExist(err) {
+		log.Printf("No %s.sha256, skipping the archive checksum\n", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return fmt.Errorf("%s.sha256 is empty", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(hasher.Sum(nil)); sum != fields[0] {
+		return fmt.Errorf("archive checksum is %s, expected %s", sum, fields[0])
+	}
+	return nil
+}
+
+// entrySummary is what verify found in an archive entry.
+type entrySummary struct {
+	Documents int64
+	SHA256    string
+}
+
+// verify checks the archive checksum, that every document is valid BSON and
+// that every entry matches the manifest, without touching any database.
+func verify(path string) (*manifest, error) {
+	if err := verifyChecksumFile(path); err != nil {
+		return nil, err
+	}
+
+	var m *manifest
+	entries := make(map[string]entrySummary)
+	err := walkArchive(path, func(name string, r io.Reader) error {
+		if name == manifestName {
+			m = &manifest{}
+			return json.NewDecoder(r).Decode(m)
+		}
+		if m != nil {
+			return fmt.Errorf("unexpected entry after the manifest")
+		}
+		if _, ok := entries[name]; ok {
+			return fmt.Errorf("duplicated entry")
+		}
+
+		hasher := sha256.New()
+		n, err := readDocuments(io.TeeReader(r, hasher), func(bson.Raw) error { return nil })
+		if err != nil {
+			return err
+		}
+		entries[name] = entrySummary{Documents: n, SHA256: hex.EncodeToString(hasher.Sum(nil))}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if m == nil {
+		return nil, fmt.Errorf("missing %s", manifestName)
+	}
+	if m.FormatVersion != formatVersion {
+		return nil, fmt.Errorf("unsupported format version %d", m.FormatVersion)
+	}
+	for _, c := range m.Collections {
+		data, ok := entries[dataEntry(c.Name)]
+		if !ok {
+			return nil, fmt.Errorf("missing %s", dataEntry(c.Name))
+		}
+		if data.SHA256 != c.DataSHA256 || data.Documents != c.Documents {
+			return nil, fmt.Errorf("%s has %d documents with checksum %s, expected %d with %s",
+				dataEntry(c.Name), data.Documents, data.SHA256, c.Documents, c.DataSHA256)
+		}
+		indexes, ok := entries[indexesEntry(c.Name)]
+		if !ok {
+			return nil, fmt.Errorf("missing %s", indexesEntry(c.Name))
+		}
+		if indexes.SHA256 != c.IndexesSHA256 || indexes.Documents != c.Indexes {
+			return nil, fmt.Errorf("%s has %d indexes with checksum %s, expected %d with %s",
+				indexesEntry(c.Name), indexes.Documents, indexes.SHA256, c.Indexes, c.IndexesSHA256)
+		}
+		delete(entries, dataEntry(c.Name))
+		delete(entries, indexesEntry(c.Name))
+	}
+	for name := range entries {
+		return nil, fmt.Errorf("%s is not in the manifest", name)
+	}
+	return m, nil
+}
+
+// restore verifies the snapshot, then loads it into db, which must not hold
+// any document of the snapshotted collections.
+func restore(ctx context.Context, db *mongo.Database, path string) (*manifest, error) {
+	m, err := verify(path)
+	if err != nil {
+		return nil, fmt.Errorf("verifying snapshot: %v", err)
+	}
+
+	for _, c := range m.Collections {
+		n, err := db.Collection(c.Name).CountDocuments(ctx, bson.D{}, options.Count().SetLimit(1))
+		if err != nil {
+			return nil, fmt.Errorf("inspecting %s: %v", c.Name, err)
+		}
+		if n > 0 {
+			return nil, fmt.Errorf("collection %s isn't empty, snapshots are only restored into an empty store", c.Name)
+		}
+	}
+
+	err = walkArchive(path, func(name string, r io.Reader) error {
+		switch {
+		case strings.HasPrefix(name, "data/"):
+			return restoreDocuments(ctx, db.Collection(strings.TrimSuffix(strings.TrimPrefix(name, "data/"), ".bson")), r)
+		case strings.HasPrefix(name, "indexes/"):
+			return restoreIndexes(ctx, db, strings.TrimSuffix(strings.TrimPrefix(name, "indexes/"), ".bson"), r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%v; the store is partially restored and must be emptied before retrying", err)
+	}
+	return m, nil
+}
+
+func restoreDocuments(ctx context.Context, collection *mongo.Collection, r io.Reader) error {
+	batch := make([]interface{}, 0, restoreBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := collection.InsertMany(ctx, batch)
+		batch = batch[:0]
+		return err
+	}
+
+	_, err := readDocuments(r, func(doc bson.Raw) error {
+		batch = append(batch, doc)
+		if len(batch) < restoreBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// restoreIndexes recreates the indexes from their definitions, except the
+// one on _id every collection has.
+func restoreIndexes(ctx context.Context, db *mongo.Database, collection string, r io.Reader) error {
+	var specs bson.A
+	_, err := readDocuments(r, func(doc bson.Raw) error {
+		spec := bson.D{}
+		if err := bson.Unmarshal(doc, &spec); err != nil {
+			return err
+		}
+
+		var kept bson.D
+		isID := false
+		for _, e := range spec {
+			switch e.Key {
+			case "ns", "v":
+				// Set by the server
+				continue
+			case "name":
+				isID = e.Value == "_id_"
+			}
+			kept = append(kept, e)
+		}
+		if !isID {
+			specs = append(specs, kept)
+		}
+		return nil
+	})
+	if err != nil || len(specs) == 0 {
+		return err
+	}
+
+	return db.RunCommand(ctx, bson.D{
+		{Key: "createIndexes", Value: collection},
+		{Key: "indexes", Value: specs},
+	}).Err()
+}
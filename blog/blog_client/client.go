@@ -1,149 +1,146 @@
 package main
 
 import (
-	"context"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
 
-	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
 
-	"github.com/yurianxdev/grpc-course/blog/blogpb"
+	"github.com/yurianxdev/grpc-course/blog/blogclient"
 )
 
-func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-
-	log.Println("Starting rpc client...")
-	conn, err := grpc.Dial(":50051", grpc.WithInsecure())
-	if err != nil {
-		log.Fatalf("Failed dialing: %v", err)
-	}
-	defer conn.Close()
-	log.Println("Successfully dial with RPC server on port 50051")
-
-	c := blogpb.NewBlogServiceClient(conn)
-	id := createBlog(c, &blogpb.Blog{
-		AuthorId: "Julian",
-		Title:    "My first blog",
-		Content:  "Some content",
-	})
-	readBlog(c, "SomeRandomId") // This will fail
-	readBlog(c, id)             // Found blog created just before
-	updateBlog(c, id)
-	readBlog(c, id)
-	deleteBlog(c, id) // Delete the only blog
+// cli holds the client and output shared by every command.
+type cli struct {
+	client *blogclient.Client
+	out    *output
+	// stdin is read by the commands taking content from "-"
+	stdin io.Reader
+}
 
-	// Create some record for testing
-	createBlog(c, &blogpb.Blog{
-		AuthorId: "Julian",
-		Title:    "Some blog",
-		Content:  "Some content",
-	})
-	createBlog(c, &blogpb.Blog{
-		AuthorId: "Bryan",
-		Title:    "My third blog",
-		Content:  "Some content",
-	})
-	createBlog(c, &blogpb.Blog{
-		AuthorId: "Rincon",
-		Title:    "Blog",
-		Content:  "Some content",
-	})
-	createBlog(c, &blogpb.Blog{
-		AuthorId: "Garzon",
-		Title:    "Another blog",
-		Content:  "Some content",
-	})
+// command runs a subcommand with the arguments following its name.
+type command struct {
+	Usage string
+	Run   func(c *cli, args []string) error
+}
 
-	listBlogs(c)
+// commands is set in init because the commands print their usage from it.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"create": {"create -title T [-author A] [-tags a,b] [-content C | -file F] [-id ID]", runCreate},
+		"read":   {"read ID", runRead},
+		"update": {"update [-title T] [-author A] [-tags a,b] [-content C | -file F] [-allow-missing] ID", runUpdate},
+		"delete": {"delete ID", runDelete},
+		"list":   {"list [-order default|popularity]", runList},
+		"search": {"search [-author A] [-tag T] TERMS...", runSearch},
+		"edit":   {"edit ID", runEdit},
+		"sync":   {"sync [-dir D] [-author A]", runSync},
+		"shell":  {"shell", runShell},
+	}
 }
 
-func listBlogs(c blogpb.BlogServiceClient) {
-	log.Println("Calling ListBlog RPC...")
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage: %s [flags] <command> [command flags] [args]\n\nCommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\n", commands[name].Usage)
+	}
+	fmt.Fprintf(w, "\nContent is read from the -file path, or from stdin when it is \"-\".\n")
+	fmt.Fprintf(w, "edit opens the content in $VISUAL or $EDITOR and updates the blog once saved.\n")
+	fmt.Fprintf(w, "sync mirrors the blogs into a directory, pushing the local edits and pulling the\n")
+	fmt.Fprintf(w, "remote ones; edits made on both sides are merged, conflicts left in the files.\n")
+	fmt.Fprintf(w, "shell runs commands interactively over a single connection.\n\nFlags:\n")
+	flag.PrintDefaults()
+}
 
-	stream, err := c.ListBlog(context.Background(), &blogpb.ListBlogRequest{})
+func main() {
+	addr := flag.String("addr", "localhost:50051", "address of the blog server")
+	useTLS := flag.Bool("tls", false, "connect with TLS")
+	caFile := flag.String("ca-file", "", "PEM file of the CA verifying the server, the system roots when empty")
+	token := flag.String("token", os.Getenv("BLOG_TOKEN"), "bearer token, defaults to $BLOG_TOKEN")
+	tenant := flag.String("tenant", "", "tenant to operate on, sent as x-tenant-id")
+	timeout := flag.Duration("timeout", 10*time.Second, "deadline of every call, 0 for none")
+	format := flag.String("output", "table", "output format: table or json")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	out, err := newOutput(os.Stdout, *format)
 	if err != nil {
-		log.Printf("Error calling ListBlog RPC: %v\n", err)
-		return
+		fail(err)
 	}
 
-	for {
-		res, err := stream.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			log.Printf("Error recieving data: %v\n", err)
-			break
-		}
-
-		fmt.Printf("Blog recived: %v\n", res.GetBlog())
+	opts := []blogclient.Option{
+		blogclient.WithAddress(*addr),
+		blogclient.WithToken(*token),
+		blogclient.WithTenant(*tenant),
+		blogclient.WithTimeout(*timeout),
 	}
-
-	err = stream.CloseSend()
+	if *useTLS {
+		opts = append(opts, blogclient.WithTLS(nil))
+	}
+	if *caFile != "" {
+		opts = append(opts, blogclient.WithCAFile(*caFile))
+	}
+	client, err := blogclient.New(opts...)
 	if err != nil {
-		log.Printf("Error closing stream: %v\n", err)
+		fail(err)
 	}
-}
+	defer client.Close()
 
-func deleteBlog(c blogpb.BlogServiceClient, id string) {
-	log.Println("Calling DeleteBlog RPC...")
-
-	deleteRes, err := c.DeleteBlog(context.Background(), &blogpb.DeleteBlogRequest{
-		BlogId: id,
-	})
-	if err != nil {
-		log.Printf("Error deleting blog, %v\n", err)
+	c := &cli{client: client, out: out, stdin: os.Stdin}
+	err = cmd.Run(c, flag.Args()[1:])
+	if err == flag.ErrHelp {
 		return
 	}
-
-	fmt.Printf("Blog deleted: %s\n", deleteRes.GetBlogId())
-}
-
-func updateBlog(c blogpb.BlogServiceClient, id string) {
-	log.Println("Calling UpdateBlog RPC...")
-
-	res, err := c.UpdateBlog(context.Background(), &blogpb.UpdateBlogRequest{
-		Blog: &blogpb.Blog{
-			Id:       id,
-			Title:    "Another title",
-			AuthorId: "Another author",
-			Content:  "AnotherContent",
-		},
-	})
 	if err != nil {
-		log.Printf("Error updating blog, %v\n", err)
-		return
+		client.Close()
+		fail(err)
 	}
-
-	fmt.Printf("Updated Blog: %v\n", res.GetBlog())
 }
 
-func readBlog(c blogpb.BlogServiceClient, id string) {
-	log.Println("Calling ReadBlog RPC...")
+// fail prints the error and exits.
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "blog_client: %s\n", errorMessage(err))
+	os.Exit(1)
+}
 
-	res, err := c.ReadBlog(context.Background(), &blogpb.ReadBlogRequest{
-		BlogId: id,
-	})
-	if err != nil {
-		log.Printf("Error reading blog: %v\n", err)
-		return
+// errorMessage describes the error, with its status code when it comes from
+// the server.
+func errorMessage(err error) string {
+	if st, ok := status.FromError(err); ok {
+		return fmt.Sprintf("%s: %s", st.Code(), st.Message())
 	}
-	fmt.Printf("Blog found: %v\n", res.GetBlog())
+	return err.Error()
 }
 
-func createBlog(c blogpb.BlogServiceClient, blog *blogpb.Blog) string {
-	log.Println("Calling CreateBlog RPC...")
-
-	res, err := c.CreateBlog(context.Background(), &blogpb.CreateBlogRequest{
-		Blog: blog,
-	})
-	if err != nil {
-		log.Printf("Error at CreateBlog RPC: %v\n", err)
-		return ""
+// splitTags parses a comma separated list of tags.
+func splitTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
 	}
-
-	fmt.Printf("Blog created: %v\n", res.GetBlog())
-	return res.GetBlog().GetId()
+	return tags
 }
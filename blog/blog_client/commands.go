@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/yurianxdev/grpc-course/blog/blogclient"
+	"github.com/yurianxdev/grpc-course/blog/blogpb"
+)
+
+// newFlagSet returns the flag set of a command, failing instead of exiting
+// on bad flags so the shell survives them.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	// Parse errors are returned to the caller rather than printed
+	fs.SetOutput(ioutil.Discard)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s\n", commands[name].Usage)
+		fs.SetOutput(os.Stderr)
+		fs.PrintDefaults()
+		fs.SetOutput(ioutil.Discard)
+	}
+	return fs
+}
+
+// blogFlags are the flags setting the fields of a blog.
+type blogFlags struct {
+	fs      *flag.FlagSet
+	title   *string
+	author  *string
+	tags    *string
+	content *string
+	file    *string
+}
+
+func newBlogFlags(fs *flag.FlagSet) *blogFlags {
+	return &blogFlags{
+		fs:      fs,
+		title:   fs.String("title", "", "title of the blog"),
+		author:  fs.String("author", "", "author id"),
+		tags:    fs.String("tags", "", "comma separated tags"),
+		content: fs.String("content", "", "content of the blog"),
+		file:    fs.String("file", "", "file holding the content, - for stdin"),
+	}
+}
+
+// apply sets on blog the fields given on the command line.
+func (f *blogFlags) apply(c *cli, blog *blogpb.Blog) error {
+	set := make(map[string]bool)
+	f.fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	if set["content"] && set["file"] {
+		return fmt.Errorf("-content and -file are exclusive")
+	}
+	if set["title"] {
+		blog.Title = *f.title
+	}
+	if set["author"] {
+		blog.AuthorId = *f.author
+	}
+	if set["tags"] {
+		blog.Tags = splitTags(*f.tags)
+	}
+	if set["content"] {
+		blog.Content = *f.content
+	}
+	if set["file"] {
+		content, err := readContent(c, *f.file)
+		if err != nil {
+			return err
+		}
+		blog.Content = content
+	}
+	return nil
+}
+
+// readContent reads a file, or stdin when path is "-".
+func readContent(c *cli, path string) (string, error) {
+	var r io.Reader = c.stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	}
+	data, err := ioutil.ReadAll(r)
+	return string(data), err
+}
+
+// singleID returns the only positional argument of a command.
+func singleID(fs *flag.FlagSet) (string, error) {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return "", fmt.Errorf("%s expects a blog id", fs.Name())
+	}
+	return fs.Arg(0), nil
+}
+
+func runCreate(c *cli, args []string) error {
+	fs := newFlagSet("create")
+	fields := newBlogFlags(fs)
+	id := fs.String("id", "", "id of the blog, generated by the server when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("create takes no arguments")
+	}
+
+	blog := &blogpb.Blog{Id: *id}
+	if err := fields.apply(c, blog); err != nil {
+		return err
+	}
+	if blog.Title == "" {
+		return fmt.Errorf("-title is required")
+	}
+
+	created, err := c.client.CreateBlog(context.Background(), blog)
+	if err != nil {
+		return err
+	}
+	return c.out.blog(created)
+}
+
+func runRead(c *cli, args []string) error {
+	fs := newFlagSet("read")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := singleID(fs)
+	if err != nil {
+		return err
+	}
+
+	blog, err := c.client.ReadBlog(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	return c.out.blog(blog)
+}
+
+func runUpdate(c *cli, args []string) error {
+	fs := newFlagSet("update")
+	fields := newBlogFlags(fs)
+	allowMissing := fs.Bool("allow-missing", false, "create the blog when it doesn't exist")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := singleID(fs)
+	if err != nil {
+		return err
+	}
+
+	// UpdateBlog replaces every field, start from the current ones so only
+	// the flags given change
+	blog, err := c.client.ReadBlog(context.Background(), id)
+	if errors.Is(err, blogclient.ErrNotFound) && *allowMissing {
+		blog, err = &blogpb.Blog{Id: id}, nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := fields.apply(c, blog); err != nil {
+		return err
+	}
+
+	var updated *blogpb.Blog
+	if *allowMissing {
+		updated, _, err = c.client.UpsertBlog(context.Background(), blog)
+	} else {
+		updated, err = c.client.UpdateBlog(context.Background(), blog)
+	}
+	if err != nil {
+		return err
+	}
+	return c.out.blog(updated)
+}
+
+func runDelete(c *cli, args []string) error {
+	fs := newFlagSet("delete")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := singleID(fs)
+	if err != nil {
+		return err
+	}
+
+	if err := c.client.DeleteBlog(context.Background(), id); err != nil {
+		return err
+	}
+	return c.out.deleted(id)
+}
+
+// listBlogs streams every blog to fn.
+func listBlogs(c *cli, order blogpb.ListBlogRequest_OrderBy, fn func(*blogpb.Blog) error) error {
+	it := c.client.ListBlogs(context.Background(), order)
+	defer it.Close()
+	for it.Next() {
+		if err := fn(it.Blog()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+func parseOrder(s string) (blogpb.ListBlogRequest_OrderBy, error) {
+	order, ok := blogpb.ListBlogRequest_OrderBy_value[strings.ToUpper(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown order %q", s)
+	}
+	return blogpb.ListBlogRequest_OrderBy(order), nil
+}
+
+func runList(c *cli, args []string) error {
+	fs := newFlagSet("list")
+	orderBy := fs.String("order", "default", "default or popularity")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	order, err := parseOrder(*orderBy)
+	if err != nil {
+		return err
+	}
+
+	list := c.out.list()
+	if err := listBlogs(c, order, list.add); err != nil {
+		return err
+	}
+	return list.flush()
+}
+
+// runSearch filters the listing on the client, the server having no search.
+// A blog matches when every term appears in its title, content or tags.
+func runSearch(c *cli, args []string) error {
+	fs := newFlagSet("search")
+	author := fs.String("author", "", "only blogs by this author")
+	tag := fs.String("tag", "", "only blogs with this tag")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	terms := strings.Fields(strings.ToLower(strings.Join(fs.Args(), " ")))
+	if len(terms) == 0 && *author == "" && *tag == "" {
+		fs.Usage()
+		return fmt.Errorf("search expects terms or filters")
+	}
+
+	list := c.out.list()
+	err := listBlogs(c, blogpb.ListBlogRequest_DEFAULT, func(blog *blogpb.Blog) error {
+		if matches(blog, terms, *author, *tag) {
+			return list.add(blog)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return list.flush()
+}
+
+func matches(blog *blogpb.Blog, terms []string, author, tag string) bool {
+	if author != "" && blog.GetAuthorId() != author {
+		return false
+	}
+	if tag != "" {
+		found := false
+		for _, t := range blog.GetTags() {
+			found = found || strings.EqualFold(t, tag)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	text := strings.ToLower(blog.GetTitle() + "\n" + blog.GetContent() + "\n" + strings.Join(blog.GetTags(), " "))
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"strings"
+)
+
+// Conflict markers written around the lines changed differently on both
+// sides, as git does.
+const (
+	conflictStart  = "<<<<<<< local\n"
+	conflictMiddle = "=======\n"
+	conflictEnd    = ">>>>>>> remote\n"
+)
+
+// hasConflictMarkers reports whether content holds an unresolved conflict.
+func hasConflictMarkers(content string) bool {
+	return strings.HasPrefix(content, conflictStart) || strings.Contains(content, "\n"+conflictStart)
+}
+
+// splitLines splits s after every newline, so joining the lines gives s back.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.SplitAfter(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// merge3 merges the changes made to base by local and remote line by line.
+// Chunks changed on one side only take that side; chunks changed on both
+// sides, differently, are written between conflict markers and reported by
+// conflicts.
+func merge3(base, local, remote string) (merged string, conflicts int) {
+	switch {
+	case local == remote, remote == base:
+		return local, 0
+	case local == base:
+		return remote, 0
+	}
+
+	// The lines are compared with their newline, which the last one of a
+	// text may lack
+	withNewline := func(s string) []string {
+		lines := splitLines(s)
+		if n := len(lines); n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+			lines[n-1] += "\n"
+		}
+		return lines
+	}
+	o, a, b := withNewline(base), withNewline(local), withNewline(remote)
+	matchA, matchB := matchLines(o, a), matchLines(o, b)
+
+	var out strings.Builder
+	write := func(lines []string) {
+		for _, line := range lines {
+			out.WriteString(line)
+		}
+	}
+
+	i, ja, jb := 0, 0, 0
+	for {
+		// Find the next base line kept by both sides
+		k := i
+		for k < len(o) && (matchA[k] < 0 || matchB[k] < 0) {
+			k++
+		}
+		ka, kb := len(a), len(b)
+		if k < len(o) {
+			ka, kb = matchA[k], matchB[k]
+		}
+
+		chunkO, chunkA, chunkB := o[i:k], a[ja:ka], b[jb:kb]
+		switch {
+		case equalLines(chunkA, chunkO):
+			write(chunkB)
+		case equalLines(chunkB, chunkO), equalLines(chunkA, chunkB):
+			write(chunkA)
+		default:
+			conflicts++
+			out.WriteString(conflictStart)
+			write(chunkA)
+			out.WriteString(conflictMiddle)
+			write(chunkB)
+			out.WriteString(conflictEnd)
+		}
+
+		if k == len(o) {
+			break
+		}
+		out.WriteString(o[k])
+		i, ja, jb = k+1, ka+1, kb+1
+	}
+
+	merged = out.String()
+	// Keep the missing final newline when both sides agree on it
+	if !strings.HasSuffix(local, "\n") && !strings.HasSuffix(remote, "\n") {
+		merged = strings.TrimSuffix(merged, "\n")
+	}
+	return merged, conflicts
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// matchLines returns, for every line of o, the index of the line of a it is
+// matched with by a longest common subsequence, or -1.
+func matchLines(o, a []string) []int {
+	match := make([]int, len(o))
+	for i := range match {
+		match[i] = -1
+	}
+
+	// The common prefix and suffix are matched directly, edits being
+	// usually small compared to the text
+	prefix := 0
+	for prefix < len(o) && prefix < len(a) && o[prefix] == a[prefix] {
+		match[prefix] = prefix
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(o)-prefix && suffix < len(a)-prefix && o[len(o)-1-suffix] == a[len(a)-1-suffix] {
+		match[len(o)-1-suffix] = len(a) - 1 - suffix
+		suffix++
+	}
+
+	om, am := o[prefix:len(o)-suffix], a[prefix:len(a)-suffix]
+	// lcs[i][j] is the length of the longest common subsequence of om[i:]
+	// and am[j:]
+	lcs := make([][]int32, len(om)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(am)+1)
+	}
+	for i := len(om) - 1; i >= 0; i-- {
+		for j := len(am) - 1; j >= 0; j-- {
+			switch {
+			case om[i] == am[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	for i, j := 0, 0; i < len(om) && j < len(am); {
+		switch {
+		case om[i] == am[j]:
+			match[prefix+i] = prefix + j
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return match
+}
+
+// mergeTags merges the tags added and removed by local and remote.
+func mergeTags(base, local, remote []string) []string {
+	inBase := make(map[string]bool, len(base))
+	for _, tag := range base {
+		inBase[tag] = true
+	}
+	inLocal := make(map[string]bool, len(local))
+	for _, tag := range local {
+		inLocal[tag] = true
+	}
+	inRemote := make(map[string]bool, len(remote))
+	for _, tag := range remote {
+		inRemote[tag] = true
+	}
+
+	var merged []string
+	seen := make(map[string]bool)
+	for _, tag := range append(append([]string(nil), local...), remote...) {
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		// Kept unless one side removed it
+		if !inBase[tag] || (inLocal[tag] && inRemote[tag]) {
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+// mergeField merges a single valued field. When both sides changed it
+// differently the local value wins and conflict is true.
+func mergeField(base, local, remote string) (merged string, conflict bool) {
+	switch {
+	case local == base:
+		return remote, false
+	case remote == base, local == remote:
+		return local, false
+	}
+	return local, true
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	const base = "one\ntwo\nthree\nfour\nfive\n"
+	tests := []struct {
+		name          string
+		local, remote string
+		want          string
+		conflicts     int
+	}{
+		{
+			name:   "local edit",
+			local:  "one\nTWO\nthree\nfour\nfive\n",
+			remote: base,
+			want:   "one\nTWO\nthree\nfour\nfive\n",
+		},
+		{
+			name:   "remote edit",
+			local:  base,
+			remote: "one\ntwo\nthree\nFOUR\nfive\n",
+			want:   "one\ntwo\nthree\nFOUR\nfive\n",
+		},
+		{
+			name:   "non overlapping edits",
+			local:  "one\nTWO\nthree\nfour\nfive\n",
+			remote: "one\ntwo\nthree\nFOUR\nfive\nsix\n",
+			want:   "one\nTWO\nthree\nFOUR\nfive\nsix\n",
+		},
+		{
+			name:   "identical edits",
+			local:  "one\nTWO\nthree\nfour\n",
+			remote: "one\nTWO\nthree\nfour\n",
+			want:   "one\nTWO\nthree\nfour\n",
+		},
+		{
+			name:   "identical edit of a chunk with other edits",
+			local:  "one\nTWO\nthree\nFOUR\nfive\n",
+			remote: "one\nTWO\nthree\nfour\nfive\nsix\n",
+			want:   "one\nTWO\nthree\nFOUR\nfive\nsix\n",
+		},
+		{
+			name:      "adjacent edits",
+			local:     "ONE\nTWO\nthree\nfour\nfive\n",
+			remote:    "one\nTWO\nthree\nfour\nfive\n",
+			want:      "<<<<<<< local\nONE\nTWO\n=======\none\nTWO\n>>>>>>> remote\nthree\nfour\nfive\n",
+			conflicts: 1,
+		},
+		{
+			name:      "same chunk changed differently",
+			local:     "one\nlocal\nthree\nfour\nfive\n",
+			remote:    "one\nremote\nthree\nfour\nfive\n",
+			want:      "one\n<<<<<<< local\nlocal\n=======\nremote\n>>>>>>> remote\nthree\nfour\nfive\n",
+			conflicts: 1,
+		},
+		{
+			name:      "line deleted on one side and changed on the other",
+			local:     "one\nthree\nfour\nfive\n",
+			remote:    "one\nTWO\nthree\nfour\nfive\n",
+			want:      "one\n<<<<<<< local\n=======\nTWO\n>>>>>>> remote\nthree\nfour\nfive\n",
+			conflicts: 1,
+		},
+		{
+			name:   "missing final newline on both sides",
+			local:  "one\nTWO\nthree\nfour\nfive",
+			remote: "one\ntwo\nthree\nFOUR\nfive",
+			want:   "one\nTWO\nthree\nFOUR\nfive",
+		},
+		{
+			name:   "missing final newline on one side",
+			local:  "one\nTWO\nthree\nfour\nfive",
+			remote: "one\ntwo\nthree\nFOUR\nfive\n",
+			want:   "one\nTWO\nthree\nFOUR\nfive\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := merge3(base, tt.local, tt.remote)
+			if got != tt.want || conflicts != tt.conflicts {
+				t.Errorf("merge3() = %q, %d conflicts, want %q, %d", got, conflicts, tt.want, tt.conflicts)
+			}
+			if want := tt.conflicts > 0; hasConflictMarkers(got) != want {
+				t.Errorf("hasConflictMarkers(%q) = %v, want %v", got, !want, want)
+			}
+		})
+	}
+}
+
+func TestMatchLines(t *testing.T) {
+	tests := []struct {
+		name string
+		o, a []string
+		want []int
+	}{
+		{
+			name: "equal",
+			o:    []string{"a\n", "b\n", "c\n"},
+			a:    []string{"a\n", "b\n", "c\n"},
+			want: []int{0, 1, 2},
+		},
+		{
+			name: "line changed",
+			o:    []string{"a\n", "b\n", "c\n"},
+			a:    []string{"a\n", "B\n", "c\n"},
+			want: []int{0, -1, 2},
+		},
+		{
+			name: "lines inserted",
+			o:    []string{"a\n", "b\n"},
+			a:    []string{"x\n", "a\n", "y\n", "b\n"},
+			want: []int{1, 3},
+		},
+		{
+			name: "line deleted",
+			o:    []string{"a\n", "b\n", "c\n"},
+			a:    []string{"a\n", "c\n"},
+			want: []int{0, -1, 1},
+		},
+		{
+			name: "lines moved",
+			o:    []string{"a\n", "b\n", "c\n", "d\n"},
+			a:    []string{"c\n", "a\n", "b\n", "d\n"},
+			want: []int{1, 2, -1, 3},
+		},
+		{
+			name: "empty",
+			o:    []string{"a\n"},
+			a:    nil,
+			want: []int{-1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchLines(tt.o, tt.a); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matchLines(%q, %q) = %v, want %v", tt.o, tt.a, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	tests := []struct {
+		name                string
+		base, local, remote []string
+		want                []string
+	}{
+		{
+			name:   "unchanged",
+			base:   []string{"go", "grpc"},
+			local:  []string{"go", "grpc"},
+			remote: []string{"go", "grpc"},
+			want:   []string{"go", "grpc"},
+		},
+		{
+			name:   "added on both sides",
+			base:   []string{"go"},
+			local:  []string{"go", "grpc"},
+			remote: []string{"go", "mongo"},
+			want:   []string{"go", "grpc", "mongo"},
+		},
+		{
+			name:   "same tag added on both sides",
+			base:   []string{"go"},
+			local:  []string{"go", "grpc"},
+			remote: []string{"grpc", "go"},
+			want:   []string{"go", "grpc"},
+		},
+		{
+			name:   "removed on both sides",
+			base:   []string{"go", "grpc", "mongo"},
+			local:  []string{"go", "mongo"},
+			remote: []string{"go", "grpc"},
+			want:   []string{"go"},
+		},
+		{
+			name:   "removed on one side and added on the other",
+			base:   []string{"go", "grpc"},
+			local:  []string{"go"},
+			remote: []string{"go", "grpc", "mongo"},
+			want:   []string{"go", "mongo"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeTags(tt.base, tt.local, tt.remote); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeTags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeField(t *testing.T) {
+	tests := []struct {
+		name                string
+		base, local, remote string
+		want                string
+		conflict            bool
+	}{
+		{name: "unchanged", base: "a", local: "a", remote: "a", want: "a"},
+		{name: "local change", base: "a", local: "b", remote: "a", want: "b"},
+		{name: "remote change", base: "a", local: "a", remote: "c", want: "c"},
+		{name: "identical changes", base: "a", local: "b", remote: "b", want: "b"},
+		{name: "different changes", base: "a", local: "b", remote: "c", want: "b", conflict: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflict := mergeField(tt.base, tt.local, tt.remote)
+			if got != tt.want || conflict != tt.conflict {
+				t.Errorf("mergeField(%q, %q, %q) = %q, %v, want %q, %v", tt.base, tt.local, tt.remote, got, conflict, tt.want, tt.conflict)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/yurianxdev/grpc-course/blog/blogpb"
+)
+
+// output prints the results of the commands as tables for people or as
+// protojson for scripts.
+type output struct {
+	w    io.Writer
+	json bool
+	// seen is called with the id of every blog printed, if set
+	seen func(id string)
+}
+
+func newOutput(w io.Writer, format string) (*output, error) {
+	switch format {
+	case "table":
+		return &output{w: w}, nil
+	case "json":
+		return &output{w: w, json: true}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+func (o *output) message(m proto.Message, multiline bool) error {
+	opts := protojson.MarshalOptions{}
+	if multiline {
+		opts.Indent = "  "
+	}
+	data, err := opts.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(o.w, "%s\n", data)
+	return err
+}
+
+func formatTime(ts interface{ AsTime() time.Time }) string {
+	return ts.AsTime().Local().Format("2006-01-02 15:04")
+}
+
+// blog prints every field of the blog followed by its content.
+func (o *output) blog(b *blogpb.Blog) error {
+	o.see(b)
+	if o.json {
+		return o.message(b, true)
+	}
+
+	tw := tabwriter.NewWriter(o.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID\t%s\n", b.GetId())
+	fmt.Fprintf(tw, "Title\t%s\n", b.GetTitle())
+	fmt.Fprintf(tw, "Author\t%s\n", b.GetAuthorId())
+	fmt.Fprintf(tw, "Tags\t%s\n", strings.Join(b.GetTags(), ", "))
+	fmt.Fprintf(tw, "Slug\t%s\n", b.GetSlug())
+	fmt.Fprintf(tw, "Created\t%s\n", formatTime(b.GetCreatedAt()))
+	fmt.Fprintf(tw, "Updated\t%s\n", formatTime(b.GetUpdatedAt()))
+	fmt.Fprintf(tw, "Views\t%d\n", b.GetViewCount())
+	fmt.Fprintf(tw, "Reactions\t%d\n", b.GetReactionCount())
+	fmt.Fprintf(tw, "Moderation\t%s %s\n", b.GetModerationStatus(), b.GetModerationReason())
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(o.w, "\n%s\n", b.GetContent())
+	return err
+}
+
+func (o *output) see(b *blogpb.Blog) {
+	if o.seen != nil && b.GetId() != "" {
+		o.seen(b.GetId())
+	}
+}
+
+func (o *output) deleted(id string) error {
+	if o.json {
+		return o.message(&blogpb.DeleteBlogResponse{BlogId: id}, false)
+	}
+	_, err := fmt.Fprintf(o.w, "Deleted %s\n", id)
+	return err
+}
+
+// synced prints an action taken by sync on a blog.
+func (o *output) synced(action, id, file string) error {
+	if id != "" && o.seen != nil {
+		o.seen(id)
+	}
+	if o.json {
+		data, err := json.Marshal(map[string]string{"action": action, "id": id, "file": file})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(o.w, "%s\n", data)
+		return err
+	}
+	_, err := fmt.Fprintf(o.w, "%-10s %-24s %s\n", action, id, file)
+	return err
+}
+
+// blogList prints blogs as they are received, one row or JSON line each.
+type blogList struct {
+	o  *output
+	tw *tabwriter.Writer
+}
+
+func (o *output) list() *blogList {
+	l := &blogList{o: o}
+	if !o.json {
+		l.tw = tabwriter.NewWriter(o.w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(l.tw, "ID\tAUTHOR\tTITLE\tTAGS\tUPDATED")
+	}
+	return l
+}
+
+func (l *blogList) add(b *blogpb.Blog) error {
+	l.o.see(b)
+	if l.o.json {
+		return l.o.message(b, false)
+	}
+	_, err := fmt.Fprintf(l.tw, "%s\t%s\t%s\t%s\t%s\n",
+		b.GetId(), b.GetAuthorId(), b.GetTitle(), strings.Join(b.GetTags(), ","), formatTime(b.GetUpdatedAt()))
+	return err
+}
+
+func (l *blogList) flush() error {
+	if l.tw == nil {
+		return nil
+	}
+	return l.tw.Flush()
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/chzyer/readline"
+)
+
+// maxRecentIDs is the number of blog ids offered for completion.
+const maxRecentIDs = 50
+
+// recentIDs remembers the blog ids printed lately, most recent first.
+type recentIDs struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (r *recentIDs) add(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.ids {
+		if existing == id {
+			r.ids = append(r.ids[:i], r.ids[i+1:]...)
+			break
+		}
+	}
+	r.ids = append([]string{id}, r.ids...)
+	if len(r.ids) > maxRecentIDs {
+		r.ids = r.ids[:maxRecentIDs]
+	}
+}
+
+func (r *recentIDs) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.ids...)
+}
+
+// shellCompleter completes the first word with the commands and the other
+// ones, except flags, with the recent blog ids.
+type shellCompleter struct {
+	recent *recentIDs
+}
+
+func (sc *shellCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	before := string(line[:pos])
+	start := strings.LastIndexAny(before, " \t") + 1
+	word := before[start:]
+	if strings.HasPrefix(word, "-") {
+		return nil, 0
+	}
+
+	candidates := sc.recent.list()
+	if strings.TrimSpace(before[:start]) == "" {
+		candidates = shellCommandNames()
+	}
+
+	var completions [][]rune
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) {
+			completions = append(completions, []rune(c[len(word):]+" "))
+		}
+	}
+	return completions, len([]rune(word))
+}
+
+// shellBuiltins only exist within the shell.
+var shellBuiltins = []string{"help", "exit", "quit"}
+
+func shellCommandNames() []string {
+	names := append([]string(nil), shellBuiltins...)
+	for name := range commands {
+		if name != "shell" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func shellHelp(w io.Writer) {
+	fmt.Fprintln(w, "Commands:")
+	for _, name := range shellCommandNames() {
+		if cmd, ok := commands[name]; ok {
+			fmt.Fprintf(w, "  %s\n", cmd.Usage)
+		}
+	}
+	fmt.Fprintln(w, "  help")
+	fmt.Fprintln(w, "  exit")
+}
+
+// errNoStdin is returned when a command reads content from stdin, which the
+// shell reads commands from.
+var errNoStdin = errors.New("stdin isn't available in the shell, use -file or edit")
+
+type noStdin struct{}
+
+func (noStdin) Read([]byte) (int, error) { return 0, errNoStdin }
+
+// runShell reads commands until exit or EOF, reusing the connection. A
+// failing command is reported and the shell goes on.
+func runShell(c *cli, args []string) error {
+	fs := newFlagSet("shell")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	recent := &recentIDs{}
+	c.out.seen = recent.add
+	c.stdin = noStdin{}
+
+	config := &readline.Config{
+		Prompt:          "blog> ",
+		AutoComplete:    &shellCompleter{recent: recent},
+		InterruptPrompt: "^C",
+		EOFPrompt:       "exit",
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		config.HistoryFile = filepath.Join(home, ".blog_client_history")
+	}
+	rl, err := readline.NewEx(config)
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+
+	for {
+		line, err := rl.Readline()
+		if err == readline.ErrInterrupt {
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		words, err := splitArgs(line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			continue
+		}
+		if len(words) == 0 {
+			continue
+		}
+
+		switch words[0] {
+		case "exit", "quit":
+			return nil
+		case "help":
+			shellHelp(os.Stdout)
+			continue
+		}
+		cmd, ok := commands[words[0]]
+		if !ok || words[0] == "shell" {
+			fmt.Fprintf(os.Stderr, "Unknown command %q, try help\n", words[0])
+			continue
+		}
+		if err := cmd.Run(c, words[1:]); err != nil && err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, errorMessage(err))
+		}
+	}
+}
+
+// splitArgs splits a command line into words like a shell: blanks separate
+// words unless quoted, and backslashes escape the next character outside
+// single quotes.
+func splitArgs(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// editorCommand is the editor chosen by the user, with its arguments.
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"vi"}
+}
+
+// runEdit opens the content of a blog in $EDITOR and updates the blog with
+// the saved content. Nothing is sent when the content is left unchanged.
+func runEdit(c *cli, args []string) error {
+	fs := newFlagSet("edit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := singleID(fs)
+	if err != nil {
+		return err
+	}
+
+	blog, err := c.client.ReadBlog(context.Background(), id)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile("", "blog-"+id+"-*.md")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(blog.GetContent()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	editor := editorCommand()
+	cmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %s: %v", editor[0], err)
+	}
+
+	edited, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(edited, []byte(blog.GetContent())) {
+		fmt.Fprintln(os.Stderr, "Content unchanged, blog not updated")
+		return nil
+	}
+	blog.Content = string(edited)
+
+	updated, err := c.client.UpdateBlog(context.Background(), blog)
+	if err != nil {
+		return err
+	}
+	return c.out.blog(updated)
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yurianxdev/grpc-course/blog/blogclient"
+	"github.com/yurianxdev/grpc-course/blog/blogpb"
+)
+
+// syncStateFile is the file of the synced directory remembering the version
+// of every blog at the last sync.
+const syncStateFile = ".blog_sync.json"
+
+// syncDoc is the part of a blog edited in the local files.
+type syncDoc struct {
+	Title   string   `json:"title"`
+	Author  string   `json:"author"`
+	Tags    []string `json:"tags"`
+	Content string   `json:"content"`
+}
+
+func docFromPb(b *blogpb.Blog) syncDoc {
+	return syncDoc{Title: b.GetTitle(), Author: b.GetAuthorId(), Tags: b.GetTags(), Content: b.GetContent()}
+}
+
+func (d syncDoc) toPb(id string) *blogpb.Blog {
+	return &blogpb.Blog{Id: id, Title: d.Title, AuthorId: d.Author, Tags: d.Tags, Content: d.Content}
+}
+
+func (d syncDoc) equal(other syncDoc) bool {
+	return d.Title == other.Title && d.Author == other.Author && d.Content == other.Content &&
+		strings.Join(d.Tags, ",") == strings.Join(other.Tags, ",")
+}
+
+// format writes the doc as a markdown file with a front matter:
+//
+//	---
+//	title: Hello
+//	author: ann
+//	tags: go, grpc
+//	---
+//	content
+func (d syncDoc) format() []byte {
+	return []byte(fmt.Sprintf("---\ntitle: %s\nauthor: %s\ntags: %s\n---\n%s",
+		d.Title, d.Author, strings.Join(d.Tags, ", "), d.Content))
+}
+
+// parseDoc parses a file written by format. A file without front matter is
+// all content, titled after its name.
+func parseDoc(data []byte, name string) (syncDoc, error) {
+	text := string(data)
+	if !strings.HasPrefix(text, "---\n") {
+		return syncDoc{Title: name, Content: text}, nil
+	}
+
+	header := text[len("---\n"):]
+	var doc syncDoc
+	end := strings.Index(header, "\n---\n")
+	switch {
+	case end >= 0:
+		doc.Content = header[end+len("\n---\n"):]
+		header = header[:end]
+	case strings.HasSuffix(header, "\n---"):
+		header = strings.TrimSuffix(header, "\n---")
+	default:
+		return syncDoc{}, fmt.Errorf("unterminated front matter")
+	}
+
+	for _, line := range strings.Split(header, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return syncDoc{}, fmt.Errorf("malformed front matter line %q", line)
+		}
+		// Only the space format writes after the colon is dropped, the
+		// title and author may start or end with spaces of their own
+		value := strings.TrimPrefix(parts[1], " ")
+		switch strings.TrimSpace(parts[0]) {
+		case "title":
+			doc.Title = value
+		case "author":
+			doc.Author = value
+		case "tags":
+			doc.Tags = splitTags(value)
+		default:
+			return syncDoc{}, fmt.Errorf("unknown front matter field %q", parts[0])
+		}
+	}
+	return doc, nil
+}
+
+// syncEntry is a blog as of the last sync.
+type syncEntry struct {
+	File string `json:"file"`
+	// UpdatedAt is the update time of the remote blog, RFC 3339
+	UpdatedAt string  `json:"updated_at"`
+	Base      syncDoc `json:"base"`
+}
+
+type syncState struct {
+	Blogs map[string]*syncEntry `json:"blogs"`
+}
+
+func loadSyncState(dir string) (*syncState, error) {
+	state := &syncState{Blogs: make(map[string]*syncEntry)}
+	data, err := ioutil.ReadFile(filepath.Join(dir, syncStateFile))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", syncStateFile, err)
+	}
+	if state.Blogs == nil {
+		state.Blogs = make(map[string]*syncEntry)
+	}
+	return state, nil
+}
+
+// save writes the state through a temporary file, so an interrupted sync
+// leaves the previous one.
+func (s *syncState) save(dir string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, syncStateFile+".tmp")
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, syncStateFile))
+}
+
+// syncer runs one sync of a directory.
+type syncer struct {
+	c      *cli
+	ctx    context.Context
+	dir    string
+	author string
+	state  *syncState
+	// conflicts counts the blogs left with conflicts to resolve
+	conflicts int
+}
+
+func runSync(c *cli, args []string) error {
+	fs := newFlagSet("sync")
+	dir := fs.String("dir", "blogs", "directory mirroring the blogs")
+	author := fs.String("author", "", "only pull the blogs of this author")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("sync takes no arguments")
+	}
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+	state, err := loadSyncState(*dir)
+	if err != nil {
+		return err
+	}
+	s := &syncer{c: c, ctx: context.Background(), dir: *dir, author: *author, state: state}
+
+	err = s.run()
+	// What was synced before a failure is kept
+	if saveErr := state.save(*dir); err == nil {
+		err = saveErr
+	}
+	if err == nil && s.conflicts > 0 {
+		err = fmt.Errorf("%d blogs have conflicts, resolve them and sync again", s.conflicts)
+	}
+	return err
+}
+
+func (s *syncer) run() error {
+	remote := make(map[string]*blogpb.Blog)
+	if err := listBlogs(s.c, blogpb.ListBlogRequest_DEFAULT, func(b *blogpb.Blog) error {
+		remote[b.GetId()] = b
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.md"))
+	if err != nil {
+		return err
+	}
+	// The files and ids of the blogs synced before, the latter not being
+	// pulled again once deleted
+	tracked := make(map[string]bool)
+	synced := make(map[string]bool)
+
+	ids := make([]string, 0, len(s.state.Blogs))
+	for id := range s.state.Blogs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		entry := s.state.Blogs[id]
+		tracked[entry.File] = true
+		synced[id] = true
+
+		r, ok := remote[id]
+		if !ok {
+			// The listing leaves out the blogs pending review
+			r, err = s.c.client.ReadBlog(s.ctx, id)
+			if errors.Is(err, blogclient.ErrNotFound) {
+				r, err = nil, nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := s.syncTracked(id, entry, r); err != nil {
+			return fmt.Errorf("%s: %v", entry.File, err)
+		}
+	}
+
+	for _, path := range files {
+		file := filepath.Base(path)
+		if tracked[file] {
+			continue
+		}
+		if err := s.syncNew(file, remote); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+
+	for _, id := range sortedIDs(remote) {
+		r := remote[id]
+		if _, ok := s.state.Blogs[id]; ok || synced[id] || (s.author != "" && r.GetAuthorId() != s.author) {
+			continue
+		}
+		if err := s.pull(id, r, "pulled"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedIDs(blogs map[string]*blogpb.Blog) []string {
+	ids := make([]string, 0, len(blogs))
+	for id := range blogs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// syncTracked syncs a blog synced before, r being nil when it was deleted
+// remotely.
+func (s *syncer) syncTracked(id string, entry *syncEntry, r *blogpb.Blog) error {
+	local, found, err := s.readDoc(entry.File)
+	if err != nil {
+		return err
+	}
+	localChanged := found && !local.equal(entry.Base)
+	remoteChanged := r != nil && r.GetUpdatedAt().AsTime().Format(time.RFC3339Nano) != entry.UpdatedAt
+
+	switch {
+	case !found && r == nil:
+		delete(s.state.Blogs, id)
+		return s.report("forgotten", id, entry.File)
+	case !found && remoteChanged:
+		// The remote changes would be lost with the blog
+		return s.pull(id, r, "restored")
+	case !found:
+		if err := s.c.client.DeleteBlog(s.ctx, id); err != nil && !errors.Is(err, blogclient.ErrNotFound) {
+			return err
+		}
+		delete(s.state.Blogs, id)
+		return s.report("deleted", id, entry.File)
+	case r == nil && !localChanged:
+		if err := os.Remove(filepath.Join(s.dir, entry.File)); err != nil {
+			return err
+		}
+		delete(s.state.Blogs, id)
+		return s.report("removed", id, entry.File)
+	case r == nil:
+		// Deleted remotely but edited locally, the edits are kept
+		if hasConflictMarkers(local.Content) {
+			return s.conflict(id, entry.File)
+		}
+		created, err := s.c.client.CreateBlog(s.ctx, local.toPb(id))
+		if err != nil {
+			return err
+		}
+		return s.write(id, entry.File, created, "recreated")
+	case localChanged && remoteChanged:
+		return s.merge(id, entry, local, r)
+	case localChanged:
+		if hasConflictMarkers(local.Content) {
+			return s.conflict(id, entry.File)
+		}
+		updated, err := s.c.client.UpdateBlog(s.ctx, local.toPb(id))
+		if err != nil {
+			return err
+		}
+		return s.write(id, entry.File, updated, "pushed")
+	case remoteChanged:
+		return s.pull(id, r, "pulled")
+	}
+	return nil
+}
+
+// merge merges the local and remote changes of a blog. Without conflicts
+// the result is pushed, otherwise it is written with conflict markers for
+// the user to resolve, and pushed by the next sync.
+func (s *syncer) merge(id string, entry *syncEntry, local syncDoc, r *blogpb.Blog) error {
+	base, remote := entry.Base, docFromPb(r)
+
+	var merged syncDoc
+	var titleConflict, authorConflict bool
+	merged.Title, titleConflict = mergeField(base.Title, local.Title, remote.Title)
+	merged.Author, authorConflict = mergeField(base.Author, local.Author, remote.Author)
+	merged.Tags = mergeTags(base.Tags, local.Tags, remote.Tags)
+	content, conflicts := merge3(base.Content, local.Content, remote.Content)
+	merged.Content = content
+
+	if titleConflict || authorConflict {
+		fmt.Fprintf(os.Stderr, "%s: title or author changed on both sides, keeping the local one\n", entry.File)
+	}
+	if conflicts > 0 {
+		// The base moves to the remote version, so the resolved file is
+		// pushed as a local change
+		if err := ioutil.WriteFile(filepath.Join(s.dir, entry.File), merged.format(), 0644); err != nil {
+			return err
+		}
+		entry.UpdatedAt = r.GetUpdatedAt().AsTime().Format(time.RFC3339Nano)
+		entry.Base = remote
+		return s.conflict(id, entry.File)
+	}
+
+	updated, err := s.c.client.UpdateBlog(s.ctx, merged.toPb(id))
+	if err != nil {
+		return err
+	}
+	return s.write(id, entry.File, updated, "merged")
+}
+
+// syncNew syncs a file never synced. It is created as a blog, with the id
+// of its name when it is one; a blog already having the id is merged with
+// it as if both were created from an empty one.
+func (s *syncer) syncNew(file string, remote map[string]*blogpb.Blog) error {
+	local, _, err := s.readDoc(file)
+	if err != nil {
+		return err
+	}
+	if hasConflictMarkers(local.Content) {
+		return s.conflict("", file)
+	}
+
+	name := strings.TrimSuffix(file, ".md")
+	id := ""
+	if raw, err := hex.DecodeString(name); err == nil && len(raw) == 12 {
+		id = name
+	}
+	if r, ok := remote[id]; ok && id != "" {
+		entry := &syncEntry{File: file, Base: syncDoc{}}
+		s.state.Blogs[id] = entry
+		if local.equal(docFromPb(r)) {
+			return s.write(id, file, r, "matched")
+		}
+		return s.merge(id, entry, local, r)
+	}
+
+	created, err := s.c.client.CreateBlog(s.ctx, local.toPb(id))
+	if err != nil {
+		return err
+	}
+	id = created.GetId()
+	newFile := id + ".md"
+	if newFile != file {
+		if _, err := os.Stat(filepath.Join(s.dir, newFile)); err == nil {
+			return fmt.Errorf("created blog %s but %s exists", id, newFile)
+		}
+		if err := os.Rename(filepath.Join(s.dir, file), filepath.Join(s.dir, newFile)); err != nil {
+			return err
+		}
+	}
+	return s.write(id, newFile, created, "created")
+}
+
+// pull writes the remote blog to its file.
+func (s *syncer) pull(id string, r *blogpb.Blog, action string) error {
+	file := id + ".md"
+	if entry, ok := s.state.Blogs[id]; ok {
+		file = entry.File
+	}
+	return s.write(id, file, r, action)
+}
+
+// write writes the blog as synced to file and records it.
+func (s *syncer) write(id, file string, b *blogpb.Blog, action string) error {
+	doc := docFromPb(b)
+	if err := ioutil.WriteFile(filepath.Join(s.dir, file), doc.format(), 0644); err != nil {
+		return err
+	}
+	s.state.Blogs[id] = &syncEntry{
+		File:      file,
+		UpdatedAt: b.GetUpdatedAt().AsTime().Format(time.RFC3339Nano),
+		Base:      doc,
+	}
+	return s.report(action, id, file)
+}
+
+func (s *syncer) conflict(id, file string) error {
+	s.conflicts++
+	return s.report("conflict", id, file)
+}
+
+// readDoc reads a synced file, found being false when it doesn't exist.
+func (s *syncer) readDoc(file string) (doc syncDoc, found bool, err error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, file))
+	if os.IsNotExist(err) {
+		return syncDoc{}, false, nil
+	}
+	if err != nil {
+		return syncDoc{}, false, err
+	}
+	doc, err = parseDoc(data, strings.TrimSuffix(file, ".md"))
+	if err != nil {
+		return syncDoc{}, false, err
+	}
+	doc.Tags = normalizeTags(doc.Tags)
+	return doc, true, nil
+}
+
+// normalizeTags normalizes the tags as the server stores them, so local
+// files compare equal to the blogs they were pushed as.
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+func (s *syncer) report(action, id, file string) error {
+	return s.c.out.synced(action, id, file)
+}
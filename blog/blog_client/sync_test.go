@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSyncDocRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  syncDoc
+	}{
+		{
+			name: "plain",
+			doc:  syncDoc{Title: "Hello", Author: "ann", Tags: []string{"go", "grpc"}, Content: "Some content\n"},
+		},
+		{
+			name: "spaces around the values",
+			doc:  syncDoc{Title: "  Hello  ", Author: " ann ", Tags: []string{"go"}, Content: "  indented\n"},
+		},
+		{
+			name: "colons in the values",
+			doc:  syncDoc{Title: "gRPC: the basics", Author: "ann", Content: "key: value\n"},
+		},
+		{
+			name: "front matter in the content",
+			doc:  syncDoc{Title: "Hello", Author: "ann", Content: "---\ntitle: other\n---\n"},
+		},
+		{
+			name: "empty",
+			doc:  syncDoc{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDoc(tt.doc.format(), "name")
+			if err != nil {
+				t.Fatalf("parseDoc: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.doc) {
+				t.Errorf("parseDoc(format()) = %+v, want %+v", got, tt.doc)
+			}
+		})
+	}
+}
+
+func TestParseDocWithoutFrontMatter(t *testing.T) {
+	got, err := parseDoc([]byte("Just content\n"), "notes")
+	if err != nil {
+		t.Fatalf("parseDoc: %v", err)
+	}
+	if want := (syncDoc{Title: "notes", Content: "Just content\n"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDoc() = %+v, want %+v", got, want)
+	}
+}
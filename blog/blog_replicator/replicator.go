@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	"github.com/yurianxdev/grpc-course/blog/blogclient"
+	"github.com/yurianxdev/grpc-course/blog/blogpb"
+)
+
+// maxThrottleWait is the longest the replicator waits when the target asks
+// it to slow down. Longer waits mean the daily write quota of an author is
+// spent, their blogs are then retried by the next polls.
+const maxThrottleWait = time.Minute
+
+// checkpointEvery is how many blogs are replicated between two checkpoints
+// during a poll, so a long initial copy resumes where it stopped.
+const checkpointEvery = 100
+
+// checkpoint is what was replicated, saved after every poll.
+type checkpoint struct {
+	// Blogs maps the id of every replicated blog to the hash of its
+	// replicated fields as of its last replication
+	Blogs    map[string]string `json:"blogs"`
+	LastPoll time.Time         `json:"last_poll"`
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	cp := &checkpoint{Blogs: make(map[string]string)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("parsing checkpoint %s: %v", path, err)
+	}
+	if cp.Blogs == nil {
+		cp.Blogs = make(map[string]string)
+	}
+	return cp, nil
+}
+
+// save writes the checkpoint through a temporary file, so a crash leaves the
+// previous one.
+func (cp *checkpoint) save(path string) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// replicated returns the fields of a blog the replicator copies. Counters,
+// slugs, timestamps and moderation are managed by each server.
+func replicated(b *blogpb.Blog) *blogpb.Blog {
+	return &blogpb.Blog{
+		Id:       b.GetId(),
+		AuthorId: b.GetAuthorId(),
+		Title:    b.GetTitle(),
+		Content:  b.GetContent(),
+		Tags:     b.GetTags(),
+	}
+}
+
+// blogHash identifies the replicated fields of a blog, so the blogs whose
+// counters only changed aren't copied again.
+func blogHash(b *blogpb.Blog) string {
+	data, _ := json.Marshal([]interface{}{b.GetAuthorId(), b.GetTitle(), b.GetContent(), b.GetTags()})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type replicator struct {
+	source *blogclient.Client
+	target *blogclient.Client
+	path   string
+	cp     *checkpoint
+	// listTimeout bounds the listing of the source, which reads every blog
+	listTimeout time.Duration
+}
+
+// stats counts what a poll did.
+type stats struct {
+	created, updated, deleted, failed int
+}
+
+// poll copies the source blogs changed since the last poll to the target,
+// and deletes from the target the blogs deleted from the source. Failed
+// blogs aren't checkpointed, so they are retried by the next poll.
+func (r *replicator) poll(ctx context.Context) (stats, error) {
+	var st stats
+
+	// The listing is read first so the writes to the target don't hold the
+	// source cursor open. Every blog is listed, the source can't tell which
+	// changed, so it has a deadline of its own.
+	var blogs []*blogpb.Blog
+	listCtx, cancel := context.WithTimeout(ctx, r.listTimeout)
+	it := r.source.ListBlogs(listCtx, blogpb.ListBlogRequest_DEFAULT)
+	for it.Next() {
+		blogs = append(blogs, it.Blog())
+	}
+	it.Close()
+	cancel()
+	if err := it.Err(); err != nil {
+		return st, fmt.Errorf("listing source blogs: %v", err)
+	}
+
+	listed := make(map[string]bool, len(blogs))
+	for _, b := range blogs {
+		if ctx.Err() != nil {
+			return st, ctx.Err()
+		}
+		id := b.GetId()
+		listed[id] = true
+		hash := blogHash(b)
+		if r.cp.Blogs[id] == hash {
+			continue
+		}
+
+		// Upserting keeps the id and overwrites a blog already on the target
+		var created bool
+		err := r.throttled(ctx, func() (err error) {
+			_, created, err = r.target.UpsertBlog(ctx, replicated(b))
+			return err
+		})
+		if err != nil {
+			log.Printf("Error replicating blog %s: %v\n", id, err)
+			st.failed++
+			continue
+		}
+		r.cp.Blogs[id] = hash
+		if created {
+			st.created++
+		} else {
+			st.updated++
+		}
+		if (st.created+st.updated)%checkpointEvery == 0 {
+			if err := r.cp.save(r.path); err != nil {
+				return st, err
+			}
+		}
+	}
+
+	var missing []string
+	for id := range r.cp.Blogs {
+		if !listed[id] {
+			missing = append(missing, id)
+		}
+	}
+	sort.Strings(missing)
+	for _, id := range missing {
+		if ctx.Err() != nil {
+			return st, ctx.Err()
+		}
+		// The listing leaves out the blogs pending review, only the ones
+		// gone from the source are deleted. Only admins can read them, hence
+		// the admin token the source needs.
+		_, err := r.source.ReadBlog(ctx, id)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, blogclient.ErrNotFound) {
+			log.Printf("Error reading source blog %s: %v\n", id, err)
+			st.failed++
+			continue
+		}
+		err = r.throttled(ctx, func() error {
+			return r.target.DeleteBlog(ctx, id)
+		})
+		if err != nil && !errors.Is(err, blogclient.ErrNotFound) {
+			log.Printf("Error deleting blog %s: %v\n", id, err)
+			st.failed++
+			continue
+		}
+		delete(r.cp.Blogs, id)
+		st.deleted++
+	}
+
+	r.cp.LastPoll = time.Now().UTC()
+	return st, r.cp.save(r.path)
+}
+
+// throttled calls the target, waiting and calling again when it is rate
+// limited. The rate limits and write quota of the target apply to the
+// replicator like to any client, so they slow down the initial copy.
+func (r *replicator) throttled(ctx context.Context, call func() error) error {
+	for {
+		err := call()
+		var e *blogclient.Error
+		if !errors.Is(err, blogclient.ErrRateLimited) || !errors.As(err, &e) {
+			return err
+		}
+		delay, ok := retryDelay(e)
+		if !ok || delay > maxThrottleWait {
+			return err
+		}
+		log.Printf("Target rate limited, waiting %v\n", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// retryDelay returns how long the server asked to wait before retrying.
+func retryDelay(e *blogclient.Error) (time.Duration, bool) {
+	for _, detail := range e.GRPCStatus().Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+// run polls until ctx is done, or once.
+func (r *replicator) run(ctx context.Context, interval time.Duration, once bool) error {
+	if r.cp.LastPoll.IsZero() {
+		log.Println("No checkpoint, copying every blog")
+	} else {
+		log.Printf("Resuming from the checkpoint of %s, %d blogs replicated\n", r.cp.LastPoll.Format(time.RFC3339), len(r.cp.Blogs))
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		st, err := r.poll(ctx)
+		if ctx.Err() != nil {
+			// Keep what was replicated before the interruption
+			return r.cp.save(r.path)
+		}
+		if err != nil {
+			if once {
+				return err
+			}
+			// The source may be down for a while, the next poll retries
+			log.Printf("Error polling: %v\n", err)
+		} else {
+			log.Printf("Poll done in %v: %d created, %d updated, %d deleted, %d failed\n",
+				time.Since(start).Round(time.Millisecond), st.created, st.updated, st.deleted, st.failed)
+		}
+		if once {
+			if st.failed > 0 {
+				return fmt.Errorf("%d blogs failed to replicate", st.failed)
+			}
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// newClient connects to one of the servers.
+func newClient(addr, token, tenant, caFile string, useTLS bool, timeout time.Duration) (*blogclient.Client, error) {
+	opts := []blogclient.Option{
+		blogclient.WithAddress(addr),
+		blogclient.WithToken(token),
+		blogclient.WithTenant(tenant),
+		blogclient.WithTimeout(timeout),
+	}
+	if useTLS {
+		opts = append(opts, blogclient.WithTLS(nil))
+	}
+	if caFile != "" {
+		opts = append(opts, blogclient.WithCAFile(caFile))
+	}
+	return blogclient.New(opts...)
+}
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	sourceAddr := flag.String("source", "localhost:50051", "address of the source blog server")
+	sourceToken := flag.String("source-token", os.Getenv("BLOG_SOURCE_TOKEN"), "bearer token of an admin of the source, so blogs pending review aren't taken for deleted, defaults to $BLOG_SOURCE_TOKEN")
+	sourceTenant := flag.String("source-tenant", "", "tenant to replicate from")
+	sourceCA := flag.String("source-ca-file", "", "PEM file of the CA verifying the source, implies TLS")
+	sourceTLS := flag.Bool("source-tls", false, "connect to the source with TLS")
+	targetAddr := flag.String("target", "", "address of the target blog server")
+	targetToken := flag.String("target-token", os.Getenv("BLOG_TARGET_TOKEN"), "bearer token of the target, defaults to $BLOG_TARGET_TOKEN")
+	targetTenant := flag.String("target-tenant", "", "tenant to replicate into")
+	targetCA := flag.String("target-ca-file", "", "PEM file of the CA verifying the target, implies TLS")
+	targetTLS := flag.Bool("target-tls", false, "connect to the target with TLS")
+	checkpointPath := flag.String("checkpoint", "blog_replicator.json", "file recording what was replicated")
+	interval := flag.Duration("interval", 30*time.Second, "time between two polls of the source")
+	timeout := flag.Duration("timeout", time.Minute, "deadline of every call but the source listing")
+	listTimeout := flag.Duration("list-timeout", 30*time.Minute, "deadline of the listing of every source blog, done on every poll")
+	once := flag.Bool("once", false, "poll once and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -target addr [flags]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Copies the blogs of the source to the target, keeping their ids, then polls the\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "source to apply its changes. Blogs only on the target are left alone.\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "The rate limits and daily write quota of the target apply to the replicator,\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "raise them on the target for a large initial copy. Rate limited writes are\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "retried, the blogs of authors out of quota are copied by later polls.\n\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *targetAddr == "" || flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *interval <= 0 {
+		log.Fatalf("-interval must be positive\n")
+	}
+	if *listTimeout <= 0 {
+		log.Fatalf("-list-timeout must be positive\n")
+	}
+
+	source, err := newClient(*sourceAddr, *sourceToken, *sourceTenant, *sourceCA, *sourceTLS, *timeout)
+	if err != nil {
+		log.Fatalf("Failed connecting to the source: %v\n", err)
+	}
+	defer source.Close()
+	target, err := newClient(*targetAddr, *targetToken, *targetTenant, *targetCA, *targetTLS, *timeout)
+	if err != nil {
+		log.Fatalf("Failed connecting to the target: %v\n", err)
+	}
+	defer target.Close()
+
+	cp, err := loadCheckpoint(*checkpointPath)
+	if err != nil {
+		log.Fatalf("Failed loading checkpoint: %v\n", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ch
+		log.Println("Stopping the replicator")
+		cancel()
+	}()
+
+	r := &replicator{source: source, target: target, path: *checkpointPath, cp: cp, listTimeout: *listTimeout}
+	if err := r.run(ctx, *interval, *once); err != nil {
+		source.Close()
+		target.Close()
+		log.Fatalf("Replication failed: %v\n", err)
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurianxdev/grpc-course/blog/blogpb"
+)
+
+const (
+	// maxAttachmentSize is the largest attachment accepted, in bytes.
+	maxAttachmentSize = 10 << 20
+	// downloadChunkSize is the size of the chunks sent by DownloadAttachment.
+	downloadChunkSize = 64 << 10
+	// sniffLen is the number of bytes http.DetectContentType looks at.
+	sniffLen = 512
+)
+
+// allowedAttachmentTypes are the content types, as sniffed from the content,
+// that can be attached to a blog.
+var allowedAttachmentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// attachmentMetadata is stored as the metadata of every GridFS file.
+type attachmentMetadata struct {
+	TenantID    string             `bson:"tenant_id"`
+	BlogID      primitive.ObjectID `bson:"blog_id"`
+	ContentType string             `bson:"content_type"`
+	SHA256      string             `bson:"sha256"`
+}
+
+// attachmentFile is a document of the GridFS files collection.
+type attachmentFile struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	Length   int64              `bson:"length"`
+	Filename string             `bson:"filename"`
+	Metadata attachmentMetadata `bson:"metadata"`
+}
+
+func (f *attachmentFile) toPb() *blogpb.Attachment {
+	return &blogpb.Attachment{
+		Id:          f.ID.Hex(),
+		BlogId:      f.Metadata.BlogID.Hex(),
+		Filename:    f.Filename,
+		ContentType: f.Metadata.ContentType,
+		Size:        f.Length,
+		Sha256:      f.Metadata.SHA256,
+	}
+}
+
+var attachmentsDB *mongo.Database
+
+// attachmentBucket returns the GridFS bucket holding the attachments. Buckets
+// keep per-operation state, so every request must use its own.
+func attachmentBucket(ctx context.Context) (*gridfs.Bucket, error) {
+	bucket, err := gridfs.NewBucket(attachmentsDB, options.GridFSBucket().SetName("attachments"))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = bucket.SetWriteDeadline(deadline)
+		_ = bucket.SetReadDeadline(deadline)
+	}
+	return bucket, nil
+}
+
+type attachmentServer struct{}
+
+func (s attachmentServer) UploadAttachment(stream blogpb.AttachmentService_UploadAttachmentServer) error {
+	log.Println("UploadAttachment RPC called...")
+	ctx := stream.Context()
+
+	req, err := stream.Recv()
+	if err == io.EOF {
+		return status.Errorf(codes.InvalidArgument, "Missing attachment info")
+	}
+	if err != nil {
+		log.Printf("Error receiving attachment info: %v\n", err)
+		return err
+	}
+	info := req.GetInfo()
+	if info == nil {
+		return status.Errorf(codes.InvalidArgument, "The first message must carry the attachment info")
+	}
+
+	blogID, err := primitive.ObjectIDFromHex(info.GetBlogId())
+	if err != nil {
+		log.Printf("Error parsing id: %v\n", err)
+		return status.Errorf(codes.InvalidArgument, fmt.Sprintf("Error parsing id: %v", err))
+	}
+	filename := path.Base(info.GetFilename())
+	if filename == "." || filename == "/" {
+		return status.Errorf(codes.InvalidArgument, "filename is required")
+	}
+	if info.GetSize() <= 0 || info.GetSize() > maxAttachmentSize {
+		return status.Errorf(codes.InvalidArgument, fmt.Sprintf("size must be between 1 and %d bytes", maxAttachmentSize))
+	}
+	if checksum, err := hex.DecodeString(info.GetSha256()); err != nil || len(checksum) != sha256.Size {
+		return status.Errorf(codes.InvalidArgument, "sha256 must be a hex encoded SHA-256 checksum")
+	}
+
+	if err := collection.FindOne(ctx, tenantFilter(ctx, bson.M{"_id": blogID})).Err(); err != nil {
+		log.Printf("Error finding blog: %v\n", err)
+		return findError(ctx, "Error finding blog", err)
+	}
+
+	// Buffer the beginning of the content to sniff its type before storing it
+	hasher := sha256.New()
+	var size int64
+	var head []byte
+	for len(head) < sniffLen {
+		chunk, err := recvAttachmentChunk(stream, &size, info.GetSize())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		head = append(head, chunk...)
+	}
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !allowedAttachmentTypes[contentType] {
+		return status.Errorf(codes.InvalidArgument, fmt.Sprintf("Content type %s is not allowed", contentType))
+	}
+	if declared := info.GetContentType(); declared != "" {
+		if mediaType, _, _ := mime.ParseMediaType(declared); mediaType != contentType {
+			return status.Errorf(codes.InvalidArgument, fmt.Sprintf("Declared content type %s does not match content %s", declared, contentType))
+		}
+	}
+
+	bucket, err := attachmentBucket(ctx)
+	if err != nil {
+		log.Printf("Error opening bucket: %v\n", err)
+		return storageError(ctx, "Error opening bucket", err)
+	}
+	metadata := attachmentMetadata{
+		TenantID:    tenantFromContext(ctx),
+		BlogID:      blogID,
+		ContentType: contentType,
+		SHA256:      info.GetSha256(),
+	}
+	upload, err := bucket.OpenUploadStream(filename, options.GridFSUpload().SetMetadata(metadata))
+	if err != nil {
+		log.Printf("Error opening upload stream: %v\n", err)
+		return storageError(ctx, "Error opening upload stream", err)
+	}
+
+	if err := writeAttachmentChunk(ctx, upload, hasher, head); err != nil {
+		return err
+	}
+	for {
+		chunk, err := recvAttachmentChunk(stream, &size, info.GetSize())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = upload.Abort()
+			return err
+		}
+		if err := writeAttachmentChunk(ctx, upload, hasher, chunk); err != nil {
+			return err
+		}
+	}
+
+	if size != info.GetSize() {
+		_ = upload.Abort()
+		return status.Errorf(codes.InvalidArgument, fmt.Sprintf("Received %d bytes, expected %d", size, info.GetSize()))
+	}
+	if checksum := hex.EncodeToString(hasher.Sum(nil)); checksum != info.GetSha256() {
+		_ = upload.Abort()
+		return status.Errorf(codes.DataLoss, fmt.Sprintf("Checksum mismatch: got %s, expected %s", checksum, info.GetSha256()))
+	}
+	if err := upload.Close(); err != nil {
+		log.Printf("Error closing upload stream: %v\n", err)
+		return storageError(ctx, "Error storing attachment", err)
+	}
+
+	fileID, _ := upload.FileID.(primitive.ObjectID)
+	log.Printf("Attachment %s stored for blog %s\n", fileID.Hex(), blogID.Hex())
+	return stream.SendAndClose(&blogpb.UploadAttachmentResponse{
+		Attachment: (&attachmentFile{
+			ID:       fileID,
+			Length:   size,
+			Filename: filename,
+			Metadata: metadata,
+		}).toPb(),
+	})
+}
+
+// recvAttachmentChunk receives the next chunk of an upload, adding its length
+// to size and failing once more than expected bytes have been received.
+func recvAttachmentChunk(stream blogpb.AttachmentService_UploadAttachmentServer, size *int64, expected int64) ([]byte, error) {
+	req, err := stream.Recv()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("Error receiving chunk: %v\n", err)
+		return nil, err
+	}
+	if req.GetInfo() != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "The attachment info can only be sent once")
+	}
+
+	chunk := req.GetChunk()
+	*size += int64(len(chunk))
+	if *size > expected {
+		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Received more than the declared %d bytes", expected))
+	}
+	return chunk, nil
+}
+
+func writeAttachmentChunk(ctx context.Context, upload *gridfs.UploadStream, hasher hash.Hash, chunk []byte) error {
+	hasher.Write(chunk)
+	if _, err := upload.Write(chunk); err != nil {
+		log.Printf("Error writing chunk: %v\n", err)
+		_ = upload.Abort()
+		return storageError(ctx, "Error storing attachment", err)
+	}
+	return nil
+}
+
+func (s attachmentServer) DownloadAttachment(req *blogpb.DownloadAttachmentRequest, stream blogpb.AttachmentService_DownloadAttachmentServer) error {
+	log.Println("DownloadAttachment RPC called...")
+	ctx := stream.Context()
+
+	oid, err := primitive.ObjectIDFromHex(req.GetAttachmentId())
+	if err != nil {
+		log.Printf("Error parsing id: %v\n", err)
+		return status.Errorf(codes.InvalidArgument, fmt.Sprintf("Error parsing id: %v", err))
+	}
+
+	bucket, err := attachmentBucket(ctx)
+	if err != nil {
+		log.Printf("Error opening bucket: %v\n", err)
+		return storageError(ctx, "Error opening bucket", err)
+	}
+
+	file := &attachmentFile{}
+	filter := bson.M{"_id": oid, "metadata.tenant_id": tenantFromContext(ctx)}
+	if err := bucket.GetFilesCollection().FindOne(ctx, filter).Decode(file); err != nil {
+		log.Printf("Error finding attachment: %v\n", err)
+		return findError(ctx, "Error finding attachment", err)
+	}
+
+	download, err := bucket.OpenDownloadStream(oid)
+	if err != nil {
+		log.Printf("Error opening download stream: %v\n", err)
+		return storageError(ctx, "Error opening download stream", err)
+	}
+	defer download.Close()
+
+	err = stream.Send(&blogpb.DownloadAttachmentResponse{
+		Data: &blogpb.DownloadAttachmentResponse_Attachment{Attachment: file.toPb()},
+	})
+	if err != nil {
+		log.Printf("Error sending attachment info: %v\n", err)
+		return err
+	}
+
+	buf := make([]byte, downloadChunkSize)
+	for {
+		n, err := download.Read(buf)
+		if n > 0 {
+			sendErr := stream.Send(&blogpb.DownloadAttachmentResponse{
+				Data: &blogpb.DownloadAttachmentResponse_Chunk{Chunk: buf[:n]},
+			})
+			if sendErr != nil {
+				log.Printf("Error sending chunk: %v\n", sendErr)
+				return sendErr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Error reading attachment: %v\n", err)
+			return storageError(ctx, "Error reading attachment", err)
+		}
+	}
+
+	log.Printf("Attachment %s sent\n", oid.Hex())
+	return nil
+}
+
+// deleteBlogAttachments removes every attachment linked to the blog.
+func deleteBlogAttachments(ctx context.Context, blogID primitive.ObjectID) error {
+	bucket, err := attachmentBucket(ctx)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := bucket.GetFilesCollection().Find(ctx, bson.M{"metadata.blog_id": blogID},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	var files []attachmentFile
+	if err := cursor.All(ctx, &files); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if err := bucket.Delete(f.ID); err != nil && err != gridfs.ErrFileNotFound {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/yurianxdev/grpc-course/blog/blogpb"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// AuditEvent records a blog mutation. Events are only ever inserted.
+type AuditEvent struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	TenantID  string             `bson:"tenant_id"`
+	Principal string             `bson:"principal"`
+	Method    string             `bson:"method"`
+	BlogID    primitive.ObjectID `bson:"blog_id"`
+	Before    *Blog              `bson:"before,omitempty"`
+	After     *Blog              `bson:"after,omitempty"`
+	Peer      string             `bson:"peer"`
+	Timestamp time.Time          `bson:"timestamp"`
+}
+
+var auditCollection *mongo.Collection
+
+// recordAudit appends an audit event for the mutation of the blog made by the
+// current request. before is nil for creations and after for deletions. ctx
+// must be the one of the transaction making the mutation, so the mutation
+// fails when it can't be audited.
+func recordAudit(ctx context.Context, blogID primitive.ObjectID, before, after *Blog) error {
+	event := AuditEvent{
+		TenantID:  tenantFromContext(ctx),
+		Principal: principalFromContext(ctx),
+		BlogID:    blogID,
+		Before:    before,
+		After:     after,
+		Timestamp: time.Now().UTC(),
+	}
+	if method, ok := grpc.Method(ctx); ok {
+		event.Method = method
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		event.Peer = p.Addr.String()
+	}
+
+	_, err := auditCollection.InsertOne(ctx, event)
+	return err
+}
+
+func (e *AuditEvent) toPb() *blogpb.AuditEvent {
+	event := &blogpb.AuditEvent{
+		Id:        e.ID.Hex(),
+		Principal: e.Principal,
+		Method:    e.Method,
+		BlogId:    e.BlogID.Hex(),
+		Peer:      e.Peer,
+		Timestamp: timestamppb.New(e.Timestamp),
+	}
+	if e.Before != nil {
+		event.Before = blogToPb(e.Before)
+	}
+	if e.After != nil {
+		event.After = blogToPb(e.After)
+	}
+	return event
+}
+
+func (s server) ListAuditEvents(ctx context.Context, req *blogpb.ListAuditEventsRequest) (*blogpb.ListAuditEventsResponse, error) {
+	log.Println("ListAuditEvents RPC called...")
+
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	filter := tenantFilter(ctx, bson.M{})
+	if req.GetBlogId() != "" {
+		oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+		if err != nil {
+			log.Printf("Error parsing id: %v\n", err)
+			return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Error parsing id: %v", err))
+		}
+		filter["blog_id"] = oid
+	}
+	if req.GetPrincipal() != "" {
+		filter["principal"] = req.GetPrincipal()
+	}
+	if req.GetMethod() != "" {
+		filter["method"] = req.GetMethod()
+	}
+
+	timestamp := bson.M{}
+	if req.GetSince() != nil {
+		timestamp["$gte"] = req.GetSince().AsTime()
+	}
+	if req.GetUntil() != nil {
+		timestamp["$lt"] = req.GetUntil().AsTime()
+	}
+	if len(timestamp) > 0 {
+		filter["timestamp"] = timestamp
+	}
+
+	// Pages are ordered by descending id, the token is the last id returned
+	if req.GetPageToken() != "" {
+		last, err := primitive.ObjectIDFromHex(req.GetPageToken())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Invalid page token: %v", err))
+		}
+		filter["_id"] = bson.M{"$lt": last}
+	}
+
+	pageSize := int64(req.GetPageSize())
+	if pageSize <= 0 {
+		pageSize = defaultAuditPageSize
+	}
+	if pageSize > maxAuditPageSize {
+		pageSize = maxAuditPageSize
+	}
+
+	cursor, err := auditCollection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetLimit(pageSize+1))
+	if err != nil {
+		log.Printf("Error finding audit events: %v\n", err)
+		return nil, storageError(ctx, "Error finding audit events", err)
+	}
+	var events []*AuditEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		log.Printf("Error decoding data: %v\n", err)
+		return nil, storageError(ctx, "Error decoding data", err)
+	}
+
+	res := &blogpb.ListAuditEventsResponse{}
+	// The extra event only tells whether there is another page
+	if int64(len(events)) > pageSize {
+		events = events[:pageSize]
+		res.NextPageToken = events[len(events)-1].ID.Hex()
+	}
+	for _, e := range events {
+		res.Events = append(res.Events, e.toPb())
+	}
+	return res, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// anonymous is the principal of requests without credentials.
+const anonymous = "anonymous"
+
+// tokenOwner is the principal a bearer token authenticates and, optionally,
+// the only tenant it can access.
+type tokenOwner struct {
+	Principal string
+	Tenant    string
+}
+
+// tokens maps every accepted bearer token to its owner.
+var tokens = map[string]tokenOwner{}
+
+// admins are the principals allowed to call administrative RPCs.
+var admins = map[string]bool{}
+
+type principalKey struct{}
+type principalTenantKey struct{}
+
+// loadTokens reads a file of "<token> <principal> [tenant]" lines. Blank lines
+// and lines starting with # are ignored.
+func loadTokens(path string) (map[string]tokenOwner, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	loaded := map[string]tokenOwner{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 && len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected \"<token> <principal> [tenant]\"", path, line)
+		}
+		owner := tokenOwner{Principal: fields[1]}
+		if len(fields) == 3 {
+			owner.Tenant = fields[2]
+		}
+		loaded[fields[0]] = owner
+	}
+	return loaded, scanner.Err()
+}
+
+// authenticate resolves the principal from the bearer token of the request.
+// Requests without a token are anonymous, requests with an unknown one fail.
+func authenticate(ctx context.Context) (context.Context, error) {
+	owner := tokenOwner{Principal: anonymous}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("authorization"); len(values) > 0 {
+		token := strings.TrimPrefix(values[0], "Bearer ")
+		found, ok := tokens[token]
+		if !ok || token == values[0] {
+			return nil, status.Errorf(codes.Unauthenticated, "Invalid bearer token")
+		}
+		owner = found
+	}
+
+	ctx = context.WithValue(ctx, principalKey{}, owner.Principal)
+	return context.WithValue(ctx, principalTenantKey{}, owner.Tenant), nil
+}
+
+// principalFromContext returns the principal that sent the request.
+func principalFromContext(ctx context.Context) string {
+	if principal, ok := ctx.Value(principalKey{}).(string); ok {
+		return principal
+	}
+	return anonymous
+}
+
+// principalTenantFromContext returns the tenant the principal is restricted
+// to, empty when it isn't.
+func principalTenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(principalTenantKey{}).(string)
+	return tenant
+}
+
+// isAdmin reports whether the request was sent by an admin.
+func isAdmin(ctx context.Context) bool {
+	return admins[principalFromContext(ctx)]
+}
+
+// requireAdmin fails unless the request was sent by an admin.
+func requireAdmin(ctx context.Context) error {
+	if principal := principalFromContext(ctx); !admins[principal] {
+		return status.Errorf(codes.PermissionDenied, fmt.Sprintf("%s is not an admin", principal))
+	}
+	return nil
+}
+
+func authUnaryInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func authStreamInterceptor(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+}
+
+// contextStream overrides the context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurianxdev/grpc-course/blog/blogpb"
+)
+
+// viewWindow is how long a viewer's reads of the same blog count as one view.
+const viewWindow = 30 * time.Minute
+
+// Reaction is the document stored in the reactions collection. There is at
+// most one per user and blog, enforced by a unique index.
+type Reaction struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	BlogID    primitive.ObjectID `bson:"blog_id"`
+	UserID    string             `bson:"user_id"`
+	Kind      string             `bson:"kind"`
+	CreatedAt time.Time          `bson:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at"`
+}
+
+var reactionsCollection *mongo.Collection
+var viewsCollection *mongo.Collection
+
+func (s server) ReactToBlog(ctx context.Context, req *blogpb.ReactToBlogRequest) (*blogpb.ReactToBlogResponse, error) {
+	log.Println("ReactToBlog RPC called...")
+
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		log.Printf("Error parsing id: %v\n", err)
+		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Error parsing id: %v", err))
+	}
+	user, err := reactingUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	kind := req.GetKind()
+	if _, ok := blogpb.ReactionKind_name[int32(kind)]; !ok || kind == blogpb.ReactionKind_REACTION_KIND_UNSPECIFIED {
+		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Invalid reaction kind: %v", kind))
+	}
+
+	if err := collection.FindOne(ctx, tenantFilter(ctx, bson.M{"_id": oid})).Err(); err != nil {
+		log.Printf("Error finding blog: %v\n", err)
+		return nil, findError(ctx, "Error finding blog", err)
+	}
+
+	// Swap the user's reaction and get the previous one back, so every
+	// transition is counted exactly once, and count it in the same
+	// transaction
+	now := time.Now().UTC()
+	var blog *Blog
+	err = withTransaction(ctx, func(ctx context.Context) error {
+		previous := &Reaction{}
+		err := reactionsCollection.FindOneAndUpdate(ctx,
+			bson.M{"blog_id": oid, "user_id": user},
+			bson.M{
+				"$set":         bson.M{"kind": kind.String(), "updated_at": now},
+				"$setOnInsert": bson.M{"created_at": now},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+		).Decode(previous)
+
+		inc := bson.M{}
+		switch {
+		case err == mongo.ErrNoDocuments:
+			inc["reactions."+kind.String()] = 1
+			inc["reaction_count"] = 1
+		case err != nil:
+			return err
+		case previous.Kind != kind.String():
+			inc["reactions."+kind.String()] = 1
+			inc["reactions."+previous.Kind] = -1
+		}
+
+		blog, err = updateBlogCounters(ctx, oid, inc)
+		return err
+	})
+	if isDuplicateKeyError(err) {
+		// A concurrent request for the same user inserted the reaction first
+		return nil, status.Errorf(codes.Aborted, "Concurrent reaction from the same user, retry")
+	}
+	if err != nil {
+		log.Printf("Error saving reaction: %v\n", err)
+		return nil, storageError(ctx, "Error saving reaction", err)
+	}
+
+	log.Printf("User %s reacted %s to blog %s\n", user, kind, oid.Hex())
+	return &blogpb.ReactToBlogResponse{
+		Blog: blogToPb(blog),
+	}, nil
+}
+
+func (s server) RemoveReaction(ctx context.Context, req *blogpb.RemoveReactionRequest) (*blogpb.RemoveReactionResponse, error) {
+	log.Println("RemoveReaction RPC called...")
+
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		log.Printf("Error parsing id: %v\n", err)
+		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Error parsing id: %v", err))
+	}
+	user, err := reactingUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := collection.FindOne(ctx, tenantFilter(ctx, bson.M{"_id": oid})).Err(); err != nil {
+		log.Printf("Error finding blog: %v\n", err)
+		return nil, findError(ctx, "Error finding blog", err)
+	}
+
+	var blog *Blog
+	err = withTransaction(ctx, func(ctx context.Context) error {
+		removed := &Reaction{}
+		err := reactionsCollection.FindOneAndDelete(ctx, bson.M{"blog_id": oid, "user_id": user}).Decode(removed)
+		if err != nil {
+			return err
+		}
+		blog, err = updateBlogCounters(ctx, oid, bson.M{
+			"reactions." + removed.Kind: -1,
+			"reaction_count":            -1,
+		})
+		return err
+	})
+	if err == mongo.ErrNoDocuments {
+		return nil, status.Errorf(codes.NotFound, fmt.Sprintf("Reaction not found: %v", err))
+	}
+	if err != nil {
+		log.Printf("Error removing reaction: %v\n", err)
+		return nil, storageError(ctx, "Error removing reaction", err)
+	}
+
+	log.Printf("User %s removed reaction from blog %s\n", user, oid.Hex())
+	return &blogpb.RemoveReactionResponse{
+		Blog: blogToPb(blog),
+	}, nil
+}
+
+// reactingUser returns the user reacting, who is the principal of the
+// request. A user_id naming someone else is rejected.
+func reactingUser(ctx context.Context, userID string) (string, error) {
+	principal := principalFromContext(ctx)
+	if principal == anonymous {
+		return "", status.Errorf(codes.Unauthenticated, "Reacting requires a bearer token")
+	}
+	if userID != "" && userID != principal {
+		return "", status.Errorf(codes.PermissionDenied, fmt.Sprintf("%s can't react as %s", principal, userID))
+	}
+	return principal, nil
+}
+
+// updateBlogCounters atomically applies inc to the counters of the blog and
+// returns the updated document.
+func updateBlogCounters(ctx context.Context, oid primitive.ObjectID, inc bson.M) (*Blog, error) {
+	blog := &Blog{}
+	if len(inc) == 0 {
+		return blog, collection.FindOne(ctx, bson.M{"_id": oid}).Decode(blog)
+	}
+
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": oid},
+		bson.M{"$inc": inc},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(blog)
+	return blog, err
+}
+
+// recordView increments the view counter of the blog unless viewer has
+// already been counted within viewWindow. It reports whether the view counted.
+func recordView(ctx context.Context, oid primitive.ObjectID, viewer string) (bool, error) {
+	now := time.Now().UTC()
+	key := oid.Hex() + ":" + viewer
+
+	// Renew a view whose window has expired but wasn't purged by the TTL yet
+	res, err := viewsCollection.UpdateOne(ctx,
+		bson.M{"_id": key, "viewed_at": bson.M{"$lte": now.Add(-viewWindow)}},
+		bson.M{"$set": bson.M{"viewed_at": now}},
+	)
+	if err != nil {
+		return false, err
+	}
+	counted := res.ModifiedCount > 0
+
+	if !counted {
+		res, err = viewsCollection.UpdateOne(ctx,
+			bson.M{"_id": key},
+			bson.M{"$setOnInsert": bson.M{"blog_id": oid, "viewed_at": now}},
+			options.Update().SetUpsert(true),
+		)
+		if isDuplicateKeyError(err) {
+			// A concurrent read by the same viewer already counted
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		counted = res.UpsertedCount > 0
+	}
+
+	if !counted {
+		return false, nil
+	}
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$inc": bson.M{"view_count": 1}})
+	return err == nil, err
+}
+
+// viewerFromContext identifies the reader of a blog: the principal, else
+// the host of the peer. Ids sent by clients aren't trusted, anyone could
+// inflate the views by sending a new one on every read.
+func viewerFromContext(ctx context.Context) string {
+	if principal := principalFromContext(ctx); principal != anonymous {
+		return "user:" + principal
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "anonymous"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "peer:" + host
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurianxdev/grpc-course/blog/blogpb"
+)
+
+const (
+	defaultFeedLimit = 20
+	maxFeedLimit     = 100
+	// maxSitemapURLs is the limit of a single sitemap file.
+	maxSitemapURLs = 50000
+)
+
+// siteURL is the public base URL of the blog, used to build links.
+var siteURL = "http://localhost:8080"
+
+// feedQuery selects the blogs of a feed.
+type feedQuery struct {
+	Tenant   string
+	AuthorID string
+	Tag      string
+	Limit    int
+}
+
+func (q feedQuery) title() string {
+	title := "Latest blogs"
+	if q.AuthorID != "" {
+		title += " by " + q.AuthorID
+	}
+	if q.Tag != "" {
+		title += " tagged " + q.Tag
+	}
+	return title
+}
+
+// latestBlogs returns the most recently created blogs matching q.
+func latestBlogs(ctx context.Context, q feedQuery) ([]*Blog, error) {
+	filter := approvedFilter(bson.M{"tenant_id": q.Tenant})
+	if q.AuthorID != "" {
+		filter["author_id"] = q.AuthorID
+	}
+	if q.Tag != "" {
+		filter["tags"] = normalizeTag(q.Tag)
+	}
+
+	cursor, err := collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(int64(q.Limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	var blogs []*Blog
+	if err := cursor.All(ctx, &blogs); err != nil {
+		return nil, err
+	}
+	return blogs, nil
+}
+
+// blogURL is the public link of a blog.
+func blogURL(blog *Blog) string {
+	return strings.TrimRight(siteURL, "/") + "/blogs/" + blog.ID.Hex() + "/" + url.PathEscape(blog.Slug)
+}
+
+// feedURL is the public link of a feed document.
+func feedURL(name string, q feedQuery) string {
+	params := url.Values{}
+	if q.Tenant != defaultTenant {
+		params.Set("tenant", q.Tenant)
+	}
+	if q.AuthorID != "" {
+		params.Set("author", q.AuthorID)
+	}
+	if q.Tag != "" {
+		params.Set("tag", q.Tag)
+	}
+
+	link := strings.TrimRight(siteURL, "/") + "/" + name
+	if len(params) > 0 {
+		link += "?" + params.Encode()
+	}
+	return link
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Self          atomLink  `xml:"http://www.w3.org/2005/Atom link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator,omitempty"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// renderRSS renders blogs as an RSS 2.0 feed.
+func renderRSS(blogs []*Blog, q feedQuery) ([]byte, error) {
+	channel := rssChannel{
+		Title:       q.title(),
+		Link:        strings.TrimRight(siteURL, "/") + "/",
+		Description: q.title(),
+		Self:        atomLink{Href: feedURL("feed.rss", q), Rel: "self", Type: "application/rss+xml"},
+	}
+	if len(blogs) > 0 {
+		channel.LastBuildDate = blogs[0].UpdatedAt.Format(time.RFC1123Z)
+	}
+
+	for _, blog := range blogs {
+		link := blogURL(blog)
+		channel.Items = append(channel.Items, rssItem{
+			Title:       blog.Title,
+			Link:        link,
+			GUID:        rssGUID{IsPermaLink: true, Value: link},
+			Creator:     blog.AuthorID,
+			PubDate:     blog.CreatedAt.Format(time.RFC1123Z),
+			Categories:  blog.Tags,
+			Description: blog.Content,
+		})
+	}
+
+	return marshalXML(rssFeed{Version: "2.0", Channel: channel})
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Links      []atomLink     `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     atomAuthor     `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// renderAtom renders blogs as an Atom 1.0 feed.
+func renderAtom(blogs []*Blog, q feedQuery) ([]byte, error) {
+	self := feedURL("feed.atom", q)
+	feed := atomFeed{
+		ID:    self,
+		Title: q.title(),
+		Links: []atomLink{
+			{Href: self, Rel: "self", Type: "application/atom+xml"},
+			{Href: strings.TrimRight(siteURL, "/") + "/", Rel: "alternate"},
+		},
+		// An empty feed has never been updated, use the epoch
+		Updated: time.Unix(0, 0).UTC().Format(time.RFC3339),
+	}
+	if len(blogs) > 0 {
+		feed.Updated = blogs[0].UpdatedAt.UTC().Format(time.RFC3339)
+	}
+
+	for _, blog := range blogs {
+		link := blogURL(blog)
+		entry := atomEntry{
+			ID:        link,
+			Title:     blog.Title,
+			Links:     []atomLink{{Href: link, Rel: "alternate"}},
+			Published: blog.CreatedAt.UTC().Format(time.RFC3339),
+			Updated:   blog.UpdatedAt.UTC().Format(time.RFC3339),
+			Author:    atomAuthor{Name: blog.AuthorID},
+			Content:   atomContent{Type: "text", Value: blog.Content},
+		}
+		for _, tag := range blog.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return marshalXML(feed)
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// renderSitemap renders blogs as a sitemap.xml.
+func renderSitemap(blogs []*Blog) ([]byte, error) {
+	set := sitemapURLSet{}
+	for _, blog := range blogs {
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:     blogURL(blog),
+			LastMod: blog.UpdatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return marshalXML(set)
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// renderFeed renders the feed of the given format for q.
+func renderFeed(ctx context.Context, format blogpb.FeedFormat, q feedQuery) (string, []byte, error) {
+	blogs, err := latestBlogs(ctx, q)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch format {
+	case blogpb.FeedFormat_ATOM:
+		body, err := renderAtom(blogs, q)
+		return "application/atom+xml; charset=utf-8", body, err
+	default:
+		body, err := renderRSS(blogs, q)
+		return "application/rss+xml; charset=utf-8", body, err
+	}
+}
+
+// feedLimit clamps the requested number of feed entries.
+func feedLimit(limit int) int {
+	if limit <= 0 {
+		return defaultFeedLimit
+	}
+	if limit > maxFeedLimit {
+		return maxFeedLimit
+	}
+	return limit
+}
+
+func (s server) GetFeed(ctx context.Context, req *blogpb.GetFeedRequest) (*blogpb.GetFeedResponse, error) {
+	log.Println("GetFeed RPC called...")
+
+	if _, ok := blogpb.FeedFormat_name[int32(req.GetFormat())]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Invalid feed format: %v", req.GetFormat()))
+	}
+
+	contentType, body, err := renderFeed(ctx, req.GetFormat(), feedQuery{
+		Tenant:   tenantFromContext(ctx),
+		AuthorID: req.GetAuthorId(),
+		Tag:      req.GetTag(),
+		Limit:    feedLimit(int(req.GetLimit())),
+	})
+	if err != nil {
+		log.Printf("Error rendering feed: %v\n", err)
+		return nil, storageError(ctx, "Error rendering feed", err)
+	}
+
+	return &blogpb.GetFeedResponse{
+		ContentType: contentType,
+		Body:        body,
+	}, nil
+}
+
+// feedHandler serves the RSS and Atom feeds and the sitemap over HTTP.
+func feedHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed.rss", serveFeed(blogpb.FeedFormat_RSS))
+	mux.HandleFunc("/feed.atom", serveFeed(blogpb.FeedFormat_ATOM))
+	mux.HandleFunc("/sitemap.xml", serveSitemap)
+	return mux
+}
+
+func serveFeed(format blogpb.FeedFormat) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !publicFeedTenant(r) {
+			http.NotFound(w, r)
+			return
+		}
+
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		contentType, body, err := renderFeed(r.Context(), format, feedQuery{
+			Tenant:   defaultTenant,
+			AuthorID: r.URL.Query().Get("author"),
+			Tag:      r.URL.Query().Get("tag"),
+			Limit:    feedLimit(limit),
+		})
+		if err != nil {
+			log.Printf("Error rendering feed: %v\n", err)
+			http.Error(w, "Error rendering feed", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write(body)
+	}
+}
+
+func serveSitemap(w http.ResponseWriter, r *http.Request) {
+	if !publicFeedTenant(r) {
+		http.NotFound(w, r)
+		return
+	}
+
+	blogs, err := latestBlogs(r.Context(), feedQuery{Tenant: defaultTenant, Limit: maxSitemapURLs})
+	if err == nil {
+		var body []byte
+		if body, err = renderSitemap(blogs); err == nil {
+			w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+			_, _ = w.Write(body)
+			return
+		}
+	}
+
+	log.Printf("Error rendering sitemap: %v\n", err)
+	http.Error(w, "Error rendering sitemap", http.StatusInternalServerError)
+}
+
+// publicFeedTenant reports whether the tenant query parameter names the
+// default tenant. The HTTP endpoints are unauthenticated, so they only serve
+// the default tenant, the feeds of the others are read with GetFeed.
+func publicFeedTenant(r *http.Request) bool {
+	tenant := r.URL.Query().Get("tenant")
+	return tenant == "" || tenant == defaultTenant
+}
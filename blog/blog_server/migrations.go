@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migration is a versioned change to the database schema. Every migration must
+// be idempotent: it may run again if the server stops before recording it.
+type migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// appliedMigration is the document stored in schema_migrations for every
+// migration already applied.
+type appliedMigration struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// migrations must be kept sorted by version and never be reordered or
+// rewritten once released, only appended.
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "create author_id index on blog",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndex(ctx, db.Collection("blog"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "author_id", Value: 1}},
+				Options: options.Index().SetName("author_id_1"),
+			})
+		},
+	},
+	{
+		Version:     2,
+		Description: "backfill created_at and updated_at on blog",
+		Up:          backfillBlogTimestamps,
+	},
+	{
+		Version:     3,
+		Description: "create created_at index on blog",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndex(ctx, db.Collection("blog"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "created_at", Value: -1}},
+				Options: options.Index().SetName("created_at_-1"),
+			})
+		},
+	},
+	{
+		Version:     4,
+		Description: "create unique blog_id/user_id index on blog_reactions",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndex(ctx, db.Collection("blog_reactions"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "blog_id", Value: 1}, {Key: "user_id", Value: 1}},
+				Options: options.Index().SetName("blog_id_1_user_id_1").SetUnique(true),
+			})
+		},
+	},
+	{
+		Version:     5,
+		Description: "expire blog_views after the view window",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndex(ctx, db.Collection("blog_views"), mongo.IndexModel{
+				Keys: bson.D{{Key: "viewed_at", Value: 1}},
+				Options: options.Index().SetName("viewed_at_ttl").
+					SetExpireAfterSeconds(int32(viewWindow / time.Second)),
+			})
+		},
+	},
+	{
+		Version:     6,
+		Description: "backfill view_count and reaction_count on blog",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			blogs := db.Collection("blog")
+			for _, field := range []string{"view_count", "reaction_count"} {
+				_, err := blogs.UpdateMany(ctx,
+					bson.M{field: bson.M{"$exists": false}},
+					bson.M{"$set": bson.M{field: 0}},
+				)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     7,
+		Description: "create popularity index on blog",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndex(ctx, db.Collection("blog"), mongo.IndexModel{
+				Keys: bson.D{
+					{Key: "reaction_count", Value: -1},
+					{Key: "view_count", Value: -1},
+					{Key: "_id", Value: -1},
+				},
+				Options: options.Index().SetName("popularity"),
+			})
+		},
+	},
+	{
+		Version:     8,
+		Description: "create blog_id index on attachments",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndex(ctx, db.Collection("attachments.files"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "metadata.blog_id", Value: 1}},
+				Options: options.Index().SetName("metadata.blog_id_1"),
+			})
+		},
+	},
+	{
+		Version:     9,
+		Description: "backfill tags and slug on blog",
+		Up:          backfillBlogSlugs,
+	},
+	{
+		Version:     10,
+		Description: "create tags index on blog",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndex(ctx, db.Collection("blog"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "tags", Value: 1}, {Key: "created_at", Value: -1}},
+				Options: options.Index().SetName("tags_1_created_at_-1"),
+			})
+		},
+	},
+	{
+		Version:     11,
+		Description: "create audit_events indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("audit_events").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "blog_id", Value: 1}, {Key: "_id", Value: -1}},
+					Options: options.Index().SetName("blog_id_1__id_-1"),
+				},
+				{
+					Keys:    bson.D{{Key: "principal", Value: 1}, {Key: "_id", Value: -1}},
+					Options: options.Index().SetName("principal_1__id_-1"),
+				},
+			})
+			return err
+		},
+	},
+	{
+		Version:     12,
+		Description: "create outbox and webhook delivery indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("outbox").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "dispatched", Value: 1}, {Key: "_id", Value: 1}},
+					Options: options.Index().SetName("dispatched_1__id_1"),
+				},
+				{
+					// Only dispatched events have the field and expire
+					Keys:    bson.D{{Key: "dispatched_at", Value: 1}},
+					Options: options.Index().SetName("dispatched_at_ttl").SetExpireAfterSeconds(7 * 24 * 60 * 60),
+				},
+			})
+			if err != nil {
+				return err
+			}
+			return createIndex(ctx, db.Collection("webhook_deliveries"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "next_attempt_at", Value: 1}},
+				Options: options.Index().SetName("next_attempt_at_1"),
+			})
+		},
+	},
+	{
+		Version:     13,
+		Description: "backfill the default tenant",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			for name, field := range map[string]string{
+				"blog":              "tenant_id",
+				"audit_events":      "tenant_id",
+				"attachments.files": "metadata.tenant_id",
+			} {
+				_, err := db.Collection(name).UpdateMany(ctx,
+					bson.M{field: bson.M{"$exists": false}},
+					bson.M{"$set": bson.M{field: defaultTenant}},
+				)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     14,
+		Description: "scope blog and audit_events indexes to the tenant",
+		Up:          scopeIndexesToTenant,
+	},
+	{
+		Version:     15,
+		Description: "create expiry index on write_quotas",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndex(ctx, db.Collection("write_quotas"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+			})
+		},
+	},
+	{
+		Version:     16,
+		Description: "create moderation index on blog",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndex(ctx, db.Collection("blog"), mongo.IndexModel{
+				Keys: bson.D{
+					{Key: "tenant_id", Value: 1},
+					{Key: "moderation_status", Value: 1},
+					{Key: "updated_at", Value: 1},
+				},
+				Options: options.Index().SetName("tenant_id_1_moderation_status_1_updated_at_1"),
+			})
+		},
+	},
+}
+
+// runMigrations applies, in order, every migration not yet recorded in the
+// schema_migrations collection.
+func runMigrations(ctx context.Context, db *mongo.Database) error {
+	applied := db.Collection("schema_migrations")
+
+	cursor, err := applied.Find(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("listing applied migrations: %v", err)
+	}
+	var done []appliedMigration
+	if err := cursor.All(ctx, &done); err != nil {
+		return fmt.Errorf("decoding applied migrations: %v", err)
+	}
+
+	versions := make(map[int]bool, len(done))
+	for _, m := range done {
+		versions[m.Version] = true
+	}
+
+	for _, m := range migrations {
+		if versions[m.Version] {
+			continue
+		}
+
+		log.Printf("Applying migration %d: %s...\n", m.Version, m.Description)
+		if err := m.Up(ctx, db); err != nil {
+			return fmt.Errorf("migration %d (%s): %v", m.Version, m.Description, err)
+		}
+
+		_, err := applied.InsertOne(ctx, appliedMigration{
+			Version:     m.Version,
+			Description: m.Description,
+			AppliedAt:   time.Now().UTC(),
+		})
+		if err != nil && !isDuplicateKeyError(err) {
+			return fmt.Errorf("recording migration %d: %v", m.Version, err)
+		}
+	}
+
+	log.Printf("Database schema is up to date (version %d)\n", migrations[len(migrations)-1].Version)
+	return nil
+}
+
+// dropIndex drops the named index, doing nothing when it doesn't exist.
+func dropIndex(ctx context.Context, collection *mongo.Collection, name string) error {
+	const indexNotFoundCode = 27
+
+	_, err := collection.Indexes().DropOne(ctx, name)
+	if e, ok := err.(mongo.CommandError); ok && (e.Code == indexNotFoundCode || e.Name == "IndexNotFound") {
+		return nil
+	}
+	return err
+}
+
+// createIndex creates the index described by model. Creating an index that
+// already exists with the same keys and options is a no-op in MongoDB.
+func createIndex(ctx context.Context, collection *mongo.Collection, model mongo.IndexModel) error {
+	_, err := collection.Indexes().CreateOne(ctx, model)
+	return err
+}
+
+// backfillBlogTimestamps sets created_at, taken from the ObjectId, and
+// updated_at on every blog that still lacks them.
+func backfillBlogTimestamps(ctx context.Context, db *mongo.Database) error {
+	blogs := db.Collection("blog")
+
+	filter := bson.M{"created_at": bson.M{"$exists": false}}
+	cursor, err := blogs.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		data := &Blog{}
+		if err := cursor.Decode(data); err != nil {
+			return err
+		}
+
+		createdAt := data.ID.Timestamp().UTC()
+		_, err := blogs.UpdateOne(ctx,
+			bson.M{"_id": data.ID, "created_at": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"created_at": createdAt, "updated_at": createdAt}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// backfillBlogSlugs sets the slug, derived from the title, and an empty tag
+// list on every blog created before they existed.
+func backfillBlogSlugs(ctx context.Context, db *mongo.Database) error {
+	blogs := db.Collection("blog")
+
+	_, err := blogs.UpdateMany(ctx,
+		bson.M{"tags": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"tags": bson.A{}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"slug": bson.M{"$exists": false}}
+	cursor, err := blogs.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1, "title": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		data := &Blog{}
+		if err := cursor.Decode(data); err != nil {
+			return err
+		}
+
+		_, err := blogs.UpdateOne(ctx,
+			bson.M{"_id": data.ID, "slug": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"slug": slugify(data.Title)}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// scopeIndexesToTenant replaces the blog and audit_events indexes with ones
+// prefixed by tenant_id, as every query is now scoped to a tenant.
+func scopeIndexesToTenant(ctx context.Context, db *mongo.Database) error {
+	blogs := db.Collection("blog")
+	_, err := blogs.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "author_id", Value: 1}},
+			Options: options.Index().SetName("tenant_id_1_author_id_1"),
+		},
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("tenant_id_1_created_at_-1"),
+		},
+		{
+			Keys: bson.D{
+				{Key: "tenant_id", Value: 1},
+				{Key: "tags", Value: 1},
+				{Key: "created_at", Value: -1},
+			},
+			Options: options.Index().SetName("tenant_id_1_tags_1_created_at_-1"),
+		},
+		{
+			Keys: bson.D{
+				{Key: "tenant_id", Value: 1},
+				{Key: "reaction_count", Value: -1},
+				{Key: "view_count", Value: -1},
+				{Key: "_id", Value: -1},
+			},
+			Options: options.Index().SetName("tenant_popularity"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"author_id_1", "created_at_-1", "tags_1_created_at_-1", "popularity"} {
+		if err := dropIndex(ctx, blogs, name); err != nil {
+			return err
+		}
+	}
+
+	audit := db.Collection("audit_events")
+	_, err = audit.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("tenant_id_1__id_-1"),
+		},
+		{
+			Keys: bson.D{
+				{Key: "tenant_id", Value: 1},
+				{Key: "blog_id", Value: 1},
+				{Key: "_id", Value: -1},
+			},
+			Options: options.Index().SetName("tenant_id_1_blog_id_1__id_-1"),
+		},
+		{
+			Keys: bson.D{
+				{Key: "tenant_id", Value: 1},
+				{Key: "principal", Value: 1},
+				{Key: "_id", Value: -1},
+			},
+			Options: options.Index().SetName("tenant_id_1_principal_1__id_-1"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"blog_id_1__id_-1", "principal_1__id_-1"} {
+		if err := dropIndex(ctx, audit, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurianxdev/grpc-course/blog/blogpb"
+)
+
+// moderationVerdict is the outcome of moderating a blog, from the mildest to
+// the strictest.
+type moderationVerdict int
+
+const (
+	verdictAllow moderationVerdict = iota
+	verdictFlag
+	verdictReject
+)
+
+// parseVerdict reads the verdicts returned by the external checker.
+func parseVerdict(s string) (moderationVerdict, error) {
+	switch strings.ToLower(s) {
+	case "allow":
+		return verdictAllow, nil
+	case "flag":
+		return verdictFlag, nil
+	case "reject":
+		return verdictReject, nil
+	}
+	return verdictAllow, fmt.Errorf("unknown verdict %q", s)
+}
+
+type moderationResult struct {
+	Verdict moderationVerdict
+	Reason  string
+}
+
+// moderator checks a blog before it is stored.
+type moderator interface {
+	Moderate(ctx context.Context, blog *Blog) (moderationResult, error)
+}
+
+// moderationPipeline runs every moderator in order and keeps the strictest
+// verdict, stopping at the first rejection.
+type moderationPipeline []moderator
+
+func (p moderationPipeline) Moderate(ctx context.Context, blog *Blog) (moderationResult, error) {
+	result := moderationResult{Verdict: verdictAllow}
+	var reasons []string
+	for _, m := range p {
+		r, err := m.Moderate(ctx, blog)
+		if err != nil {
+			return moderationResult{}, err
+		}
+		if r.Verdict == verdictAllow {
+			continue
+		}
+		if r.Verdict > result.Verdict {
+			result.Verdict = r.Verdict
+			reasons = nil
+		}
+		if r.Verdict == result.Verdict {
+			reasons = append(reasons, r.Reason)
+		}
+		if result.Verdict == verdictReject {
+			break
+		}
+	}
+	result.Reason = strings.Join(reasons, "; ")
+	return result, nil
+}
+
+// wordListModerator rejects blogs containing a banned word and flags the ones
+// containing a word needing review. Words are matched as whole terms.
+type wordListModerator struct {
+	Banned map[string]bool
+	Review map[string]bool
+}
+
+func (m wordListModerator) Moderate(_ context.Context, blog *Blog) (moderationResult, error) {
+	terms := tokenize(blog.Title + " " + blog.Content + " " + strings.Join(blog.Tags, " "))
+
+	var review string
+	for _, t := range terms {
+		if m.Banned[t] {
+			return moderationResult{Verdict: verdictReject, Reason: fmt.Sprintf("contains banned word %q", t)}, nil
+		}
+		if review == "" && m.Review[t] {
+			review = t
+		}
+	}
+	if review != "" {
+		return moderationResult{Verdict: verdictFlag, Reason: fmt.Sprintf("contains word %q", review)}, nil
+	}
+	return moderationResult{Verdict: verdictAllow}, nil
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://|\bwww\.`)
+
+// linkCountModerator flags blogs with more than FlagAbove links and rejects
+// the ones with more than RejectAbove, a common trait of spam. A zero
+// threshold disables the check.
+type linkCountModerator struct {
+	FlagAbove   int
+	RejectAbove int
+}
+
+func (m linkCountModerator) Moderate(_ context.Context, blog *Blog) (moderationResult, error) {
+	links := len(linkPattern.FindAllStringIndex(blog.Content, -1))
+	switch {
+	case m.RejectAbove > 0 && links > m.RejectAbove:
+		return moderationResult{Verdict: verdictReject, Reason: fmt.Sprintf("contains %d links", links)}, nil
+	case m.FlagAbove > 0 && links > m.FlagAbove:
+		return moderationResult{Verdict: verdictFlag, Reason: fmt.Sprintf("contains %d links", links)}, nil
+	}
+	return moderationResult{Verdict: verdictAllow}, nil
+}
+
+// httpModerator asks an external service for a verdict. The blog is posted as
+// JSON and the service answers {"verdict": "allow|flag|reject", "reason": ""}.
+// Blogs are held for review while the service is unavailable.
+type httpModerator struct {
+	URL    string
+	Client *http.Client
+}
+
+type httpModerationRequest struct {
+	Tenant   string   `json:"tenant"`
+	AuthorID string   `json:"author_id"`
+	Title    string   `json:"title"`
+	Content  string   `json:"content"`
+	Tags     []string `json:"tags"`
+}
+
+type httpModerationResponse struct {
+	Verdict string `json:"verdict"`
+	Reason  string `json:"reason"`
+}
+
+func (m httpModerator) Moderate(ctx context.Context, blog *Blog) (moderationResult, error) {
+	r, err := m.check(ctx, blog)
+	if err != nil {
+		log.Printf("Error calling moderation checker: %v\n", err)
+		return moderationResult{Verdict: verdictFlag, Reason: "moderation checker unavailable"}, nil
+	}
+	return r, nil
+}
+
+func (m httpModerator) check(ctx context.Context, blog *Blog) (moderationResult, error) {
+	body, err := json.Marshal(httpModerationRequest{
+		Tenant:   blog.TenantID,
+		AuthorID: blog.AuthorID,
+		Title:    blog.Title,
+		Content:  blog.Content,
+		Tags:     blog.Tags,
+	})
+	if err != nil {
+		return moderationResult{}, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.URL, bytes.NewReader(body))
+	if err != nil {
+		return moderationResult{}, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := m.Client.Do(req)
+	if err != nil {
+		return moderationResult{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64<<10))
+		return moderationResult{}, fmt.Errorf("%s responded %s", m.URL, res.Status)
+	}
+	var decoded httpModerationResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&decoded); err != nil {
+		return moderationResult{}, err
+	}
+	verdict, err := parseVerdict(decoded.Verdict)
+	if err != nil {
+		return moderationResult{}, err
+	}
+	return moderationResult{Verdict: verdict, Reason: decoded.Reason}, nil
+}
+
+// moderationConfig is the JSON configuration of the moderation pipeline.
+type moderationConfig struct {
+	BannedWords      []string `json:"banned_words"`
+	ReviewWords      []string `json:"review_words"`
+	FlagLinksAbove   int      `json:"flag_links_above"`
+	RejectLinksAbove int      `json:"reject_links_above"`
+	// CheckerURL is the optional external checker
+	CheckerURL     string `json:"checker_url"`
+	CheckerTimeout string `json:"checker_timeout"`
+}
+
+// defaultModeration is used when no configuration file is given.
+var defaultModeration = moderationConfig{
+	FlagLinksAbove:   3,
+	RejectLinksAbove: 10,
+}
+
+// loadModeration reads the moderation configuration from a JSON file.
+func loadModeration(path string) (moderationConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return moderationConfig{}, err
+	}
+
+	var config moderationConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return moderationConfig{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return config, nil
+}
+
+// pipeline builds the moderators enabled by the configuration.
+func (c moderationConfig) pipeline() (moderationPipeline, error) {
+	var p moderationPipeline
+	if len(c.BannedWords) > 0 || len(c.ReviewWords) > 0 {
+		p = append(p, wordListModerator{Banned: wordSet(c.BannedWords), Review: wordSet(c.ReviewWords)})
+	}
+	if c.FlagLinksAbove > 0 || c.RejectLinksAbove > 0 {
+		p = append(p, linkCountModerator{FlagAbove: c.FlagLinksAbove, RejectAbove: c.RejectLinksAbove})
+	}
+	if c.CheckerURL != "" {
+		timeout := 5 * time.Second
+		if c.CheckerTimeout != "" {
+			d, err := time.ParseDuration(c.CheckerTimeout)
+			if err != nil {
+				return nil, fmt.Errorf("checker_timeout: %v", err)
+			}
+			timeout = d
+		}
+		p = append(p, httpModerator{URL: c.CheckerURL, Client: &http.Client{Timeout: timeout}})
+	}
+	return p, nil
+}
+
+// wordSet lowercases the words the same way blogs are tokenized.
+func wordSet(words []string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		for _, t := range tokenize(w) {
+			set[t] = true
+		}
+	}
+	return set
+}
+
+// moderation is the pipeline every created or updated blog goes through.
+var moderation moderator = moderationPipeline{}
+
+// moderate runs the pipeline on the blog and sets its moderation status. It
+// fails with InvalidArgument when the blog is rejected. before is the stored
+// blog on updates, nil on creates.
+func moderate(ctx context.Context, blog, before *Blog) error {
+	result, err := moderation.Moderate(ctx, blog)
+	if err != nil {
+		log.Printf("Error moderating blog: %v\n", err)
+		return status.Errorf(codes.Internal, fmt.Sprintf("Error moderating blog: %v", err))
+	}
+
+	switch result.Verdict {
+	case verdictReject:
+		log.Printf("Blog by %s rejected: %s\n", blog.AuthorID, result.Reason)
+		return status.Errorf(codes.InvalidArgument, fmt.Sprintf("Blog rejected by moderation: %s", result.Reason))
+	case verdictFlag:
+		blog.ModerationStatus = blogpb.ModerationStatus_PENDING_REVIEW.String()
+		blog.ModerationReason = result.Reason
+	default:
+		edited := before == nil || blog.Title != before.Title || blog.Content != before.Content
+		switch {
+		case blog.ModerationStatus == "":
+			blog.ModerationStatus = blogpb.ModerationStatus_APPROVED.String()
+		case !edited:
+			// Keep the status while the moderated text stays the same
+		case blog.ModerationStatus == blogpb.ModerationStatus_REJECTED.String():
+			// Back to the reviewers, so a rejection isn't undone by any edit
+			blog.ModerationStatus = blogpb.ModerationStatus_PENDING_REVIEW.String()
+			blog.ModerationReason = "Edited after being rejected"
+		default:
+			// The flagged text is gone
+			blog.ModerationStatus = blogpb.ModerationStatus_APPROVED.String()
+			blog.ModerationReason = ""
+		}
+	}
+	return nil
+}
+
+// approvedFilter restricts filter to the blogs that passed moderation. Blogs
+// stored before moderation existed have no status and count as approved.
+func approvedFilter(filter bson.M) bson.M {
+	filter["moderation_status"] = bson.M{"$nin": []string{
+		blogpb.ModerationStatus_PENDING_REVIEW.String(),
+		blogpb.ModerationStatus_REJECTED.String(),
+	}}
+	return filter
+}
+
+// canReadBlog reports whether the request may read the blog. Only its author
+// and the admins can while it is pending review or rejected.
+func canReadBlog(ctx context.Context, blog *Blog) bool {
+	switch blog.ModerationStatus {
+	case blogpb.ModerationStatus_PENDING_REVIEW.String(), blogpb.ModerationStatus_REJECTED.String():
+		return isAdmin(ctx) || principalFromContext(ctx) == blog.AuthorID
+	}
+	return true
+}
+
+func (s server) ListFlaggedBlogs(req *blogpb.ListFlaggedBlogsRequest, stream blogpb.BlogService_ListFlaggedBlogsServer) error {
+	log.Println("ListFlaggedBlogs RPC called...")
+	ctx := stream.Context()
+
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+
+	// Oldest first, so reviewers work through the queue in order
+	cursor, err := collection.Find(ctx,
+		tenantFilter(ctx, bson.M{"moderation_status": blogpb.ModerationStatus_PENDING_REVIEW.String()}),
+		options.Find().SetSort(bson.D{{Key: "updated_at", Value: 1}}))
+	if err != nil {
+		log.Printf("Error finding the blogs: %v\n", err)
+		return storageError(ctx, "Error finding the blogs", err)
+	}
+	defer func() {
+		// Kill the server side cursor even when the client went away
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = cursor.Close(closeCtx)
+	}()
+
+	for cursor.Next(ctx) {
+		data := &Blog{}
+		if err := cursor.Decode(data); err != nil {
+			log.Printf("Error decoding data: %v\n", err)
+			return storageError(ctx, "Error decoding data", err)
+		}
+		if err := stream.Send(&blogpb.ListFlaggedBlogsResponse{Blog: blogToPb(data)}); err != nil {
+			log.Printf("Error sending %v data: %v\n", data.ID.Hex(), err)
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Error reading the blogs: %v\n", err)
+		return storageError(ctx, "Error reading the blogs", err)
+	}
+	return nil
+}
+
+func (s server) ReviewBlog(ctx context.Context, req *blogpb.ReviewBlogRequest) (*blogpb.ReviewBlogResponse, error) {
+	log.Println("ReviewBlog RPC called...")
+
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		log.Printf("Error parsing id: %v\n", err)
+		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Error parsing id: %v", err))
+	}
+	decision := req.GetDecision()
+	if decision != blogpb.ModerationStatus_APPROVED && decision != blogpb.ModerationStatus_REJECTED {
+		return nil, status.Errorf(codes.InvalidArgument, "decision must be APPROVED or REJECTED")
+	}
+
+	filter := tenantFilter(ctx, bson.M{"_id": oid})
+	before := &Blog{}
+	if err := collection.FindOne(ctx, filter).Decode(before); err != nil {
+		log.Printf("Error finding blog: %v\n", err)
+		return nil, findError(ctx, "Error finding blog", err)
+	}
+
+	after := *before
+	after.ModerationStatus = decision.String()
+	after.ModerationReason = req.GetReason()
+	after.UpdatedAt = time.Now().UTC()
+
+	// Only held blogs can be reviewed, so concurrent reviews apply once
+	filter["moderation_status"] = blogpb.ModerationStatus_PENDING_REVIEW.String()
+	var reviewed bool
+	err = withTransaction(ctx, func(ctx context.Context) error {
+		res, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{
+			"moderation_status": after.ModerationStatus,
+			"moderation_reason": after.ModerationReason,
+			"updated_at":        after.UpdatedAt,
+		}})
+		if err != nil {
+			return err
+		}
+		if reviewed = res.ModifiedCount > 0; !reviewed {
+			return nil
+		}
+		if err := writeOutbox(ctx, blogUpdatedEvent, &after); err != nil {
+			return err
+		}
+		return recordAudit(ctx, oid, before, &after)
+	})
+	if err != nil {
+		log.Printf("Error reviewing blog: %v\n", err)
+		return nil, storageError(ctx, "Error reviewing blog", err)
+	}
+	if !reviewed {
+		return nil, status.Errorf(codes.FailedPrecondition, fmt.Sprintf("Blog %s is not pending review", oid.Hex()))
+	}
+
+	log.Printf("Blog %s reviewed: %s\n", oid.Hex(), decision)
+	return &blogpb.ReviewBlogResponse{
+		Blog: blogToPb(&after),
+	}, nil
+}
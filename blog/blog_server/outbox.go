@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Types of the blog events published through the outbox.
+const (
+	blogCreatedEvent = "blog.created"
+	blogUpdatedEvent = "blog.updated"
+	blogDeletedEvent = "blog.deleted"
+)
+
+// OutboxEvent is a blog event waiting to be dispatched to the webhooks. It is
+// written in the same transaction as the mutation it describes.
+type OutboxEvent struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty"`
+	Type   string             `bson:"type"`
+	BlogID primitive.ObjectID `bson:"blog_id"`
+	// Blog after the mutation, or the deleted one
+	Blog         *Blog      `bson:"blog"`
+	CreatedAt    time.Time  `bson:"created_at"`
+	Dispatched   bool       `bson:"dispatched"`
+	DispatchedAt *time.Time `bson:"dispatched_at,omitempty"`
+}
+
+var mongoClient *mongo.Client
+var outboxCollection *mongo.Collection
+
+// transactionsSupported tells whether the deployment is a replica set or a
+// sharded cluster, the only ones supporting multi-document transactions.
+var transactionsSupported bool
+
+// detectTransactions asks the server whether it supports transactions.
+func detectTransactions(ctx context.Context, db *mongo.Database) (bool, error) {
+	var res struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := db.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&res); err != nil {
+		return false, err
+	}
+	return res.SetName != "" || res.Msg == "isdbgrid", nil
+}
+
+// withTransaction runs fn in a transaction, retrying it on transient errors.
+// On deployments without transactions fn runs on its own; the outbox is then
+// only as reliable as the server staying up between the two writes.
+func withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !transactionsSupported {
+		return fn(ctx)
+	}
+
+	return mongoClient.UseSession(ctx, func(sc mongo.SessionContext) error {
+		_, err := sc.WithTransaction(sc, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc)
+		})
+		return err
+	})
+}
+
+// writeOutbox adds an event about the blog to the outbox. ctx must be the one
+// of the transaction making the mutation.
+func writeOutbox(ctx context.Context, eventType string, blog *Blog) error {
+	_, err := outboxCollection.InsertOne(ctx, OutboxEvent{
+		Type:      eventType,
+		BlogID:    blog.ID,
+		Blog:      blog,
+		CreatedAt: time.Now().UTC(),
+	})
+	return err
+}
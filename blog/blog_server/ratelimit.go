@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// rateLimit is a token bucket refilled with Rate tokens per second up to
+// Burst tokens. A zero Rate means unlimited.
+type rateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// rateLimitConfig is the JSON configuration of the rate limits.
+type rateLimitConfig struct {
+	// Default applies to the methods without their own limit
+	Default rateLimit `json:"default"`
+	// Methods maps full method names, e.g. /blog.BlogService/CreateBlog, to
+	// their limit
+	Methods map[string]rateLimit `json:"methods"`
+	// DailyWriteQuota is the number of blogs every author can create or
+	// update per UTC day, 0 meaning unlimited
+	DailyWriteQuota int64 `json:"daily_write_quota"`
+}
+
+// defaultRateLimits are used when no configuration file is given.
+var defaultRateLimits = rateLimitConfig{
+	Default: rateLimit{Rate: 50, Burst: 100},
+	Methods: map[string]rateLimit{
+		"/blog.BlogService/CreateBlog":             {Rate: 1, Burst: 10},
+		"/blog.BlogService/UpdateBlog":             {Rate: 2, Burst: 20},
+		"/blog.BlogService/DeleteBlog":             {Rate: 2, Burst: 20},
+		"/blog.AttachmentService/UploadAttachment": {Rate: 0.5, Burst: 5},
+	},
+	DailyWriteQuota: 1000,
+}
+
+// loadRateLimits reads the rate limit configuration from a JSON file.
+func loadRateLimits(path string) (rateLimitConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return rateLimitConfig{}, err
+	}
+
+	var config rateLimitConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return rateLimitConfig{}, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := config.Default.validate(); err != nil {
+		return rateLimitConfig{}, fmt.Errorf("%s: default limit: %v", path, err)
+	}
+	for method, limit := range config.Methods {
+		if err := limit.validate(); err != nil {
+			return rateLimitConfig{}, fmt.Errorf("%s: limit for %s: %v", path, method, err)
+		}
+	}
+	return config, nil
+}
+
+// validate rejects the limits a bucket can't enforce. A bucket of a limited
+// method needs room for at least one token, else every call is refused.
+func (l rateLimit) validate() error {
+	if l.Rate < 0 || l.Burst < 0 {
+		return fmt.Errorf("negative limit")
+	}
+	if l.Rate > 0 && l.Burst < 1 {
+		return fmt.Errorf("burst must be at least 1 with a rate of %v", l.Rate)
+	}
+	return nil
+}
+
+func (c rateLimitConfig) limit(method string) rateLimit {
+	if limit, ok := c.Methods[method]; ok {
+		return limit
+	}
+	return c.Default
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take removes a token from the bucket, refilled since its last use. When
+// empty it returns how long until a token is available.
+func (b *tokenBucket) take(now time.Time, limit rateLimit) (time.Duration, bool) {
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second)), false
+}
+
+// rateLimiter keeps a token bucket per client and method.
+type rateLimiter struct {
+	config rateLimitConfig
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(config rateLimitConfig) *rateLimiter {
+	return &rateLimiter{
+		config:    config,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token for the client calling method. When none is left it
+// returns how long the client should wait before retrying.
+func (l *rateLimiter) allow(client, method string) (time.Duration, bool) {
+	limit := l.config.limit(method)
+	if limit.Rate <= 0 {
+		return 0, true
+	}
+
+	now := time.Now()
+	key := client + " " + method
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = bucket
+	}
+	return bucket.take(now, limit)
+}
+
+// sweep forgets, at most once a minute, the buckets idle long enough to be
+// full again. Callers must hold the lock.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) > 10*time.Minute {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimitClient identifies the caller: its principal when authenticated,
+// its IP address otherwise.
+func rateLimitClient(ctx context.Context) string {
+	if principal := principalFromContext(ctx); principal != anonymous {
+		return "principal:" + principal
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return anonymous
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "ip:" + host
+}
+
+// resourceExhausted builds the error telling the client when to retry.
+func resourceExhausted(retryAfter time.Duration, msg string, details ...*errdetails.QuotaFailure) error {
+	st := status.New(codes.ResourceExhausted, msg)
+	withDetails, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	if err != nil {
+		return st.Err()
+	}
+	for _, d := range details {
+		if st, err := withDetails.WithDetails(d); err == nil {
+			withDetails = st
+		}
+	}
+	return withDetails.Err()
+}
+
+func (l *rateLimiter) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if retryAfter, ok := l.allow(rateLimitClient(ctx), info.FullMethod); !ok {
+		return nil, resourceExhausted(retryAfter, fmt.Sprintf("Rate limit exceeded for %s", info.FullMethod))
+	}
+	return handler(ctx, req)
+}
+
+func (l *rateLimiter) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if retryAfter, ok := l.allow(rateLimitClient(stream.Context()), info.FullMethod); !ok {
+		return resourceExhausted(retryAfter, fmt.Sprintf("Rate limit exceeded for %s", info.FullMethod))
+	}
+	return handler(srv, stream)
+}
+
+// dailyWriteQuota is the number of writes per author and day, 0 meaning
+// unlimited.
+var dailyWriteQuota int64
+
+var quotasCollection *mongo.Collection
+
+// consumeWriteQuota counts a write by the author against the daily quota, or
+// fails with ResourceExhausted once it is spent. ctx must be the one of the
+// transaction making the write, so failed writes aren't counted. Storage
+// errors are returned as is for the transaction to retry them.
+func consumeWriteQuota(ctx context.Context, author string) error {
+	if dailyWriteQuota <= 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	day := now.Truncate(24 * time.Hour)
+	tomorrow := day.Add(24 * time.Hour)
+	tenant := tenantFromContext(ctx)
+
+	// The filter only matches while there is quota left. Once spent, the
+	// upsert collides with the existing document on its _id.
+	_, err := quotasCollection.UpdateOne(ctx,
+		bson.M{
+			"_id":   tenant + "/" + author + "/" + day.Format("2006-01-02"),
+			"count": bson.M{"$lt": dailyWriteQuota},
+		},
+		bson.M{
+			"$inc":         bson.M{"count": 1},
+			"$setOnInsert": bson.M{"tenant_id": tenant, "author_id": author, "expires_at": tomorrow},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if isDuplicateKeyError(err) {
+		return resourceExhausted(tomorrow.Sub(now),
+			fmt.Sprintf("Daily write quota of %d exceeded for author %s", dailyWriteQuota, author),
+			&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{
+				Subject:     "author:" + author,
+				Description: fmt.Sprintf("%d writes per day", dailyWriteQuota),
+			}}},
+		)
+	}
+	return err
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurianxdev/grpc-course/blog/blogpb"
+)
+
+const (
+	defaultRelatedLimit = 5
+	maxRelatedLimit     = 20
+
+	// Weight of a term depending on where it appears in the blog.
+	contentWeight = 1
+	titleWeight   = 2
+	tagWeight     = 3
+)
+
+// stopWords are too common to tell blogs apart.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "from": true, "has": true,
+	"have": true, "in": true, "is": true, "it": true, "its": true, "of": true,
+	"on": true, "or": true, "that": true, "the": true, "this": true, "to": true,
+	"was": true, "were": true, "will": true, "with": true, "you": true, "your": true,
+}
+
+// termIndex keeps the term frequencies of every blog to compute TF-IDF
+// cosine similarities. It is safe for concurrent use.
+type termIndex struct {
+	mu sync.RWMutex
+	// docs holds the weighted term frequencies of every blog
+	docs map[primitive.ObjectID]map[string]float64
+	// postings lists the blogs containing every term
+	postings map[string]map[primitive.ObjectID]struct{}
+	// tenants holds the tenant of every blog, only blogs of the same tenant
+	// can be related
+	tenants map[primitive.ObjectID]string
+}
+
+func newTermIndex() *termIndex {
+	return &termIndex{
+		docs:     make(map[primitive.ObjectID]map[string]float64),
+		postings: make(map[string]map[primitive.ObjectID]struct{}),
+		tenants:  make(map[primitive.ObjectID]string),
+	}
+}
+
+// relatedIndex is the term index of all the stored blogs.
+var relatedIndex = newTermIndex()
+
+// tokenize splits text into lowercase terms, dropping stop words and single
+// characters.
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := fields[:0]
+	for _, f := range fields {
+		if len([]rune(f)) < 2 || stopWords[f] {
+			continue
+		}
+		terms = append(terms, f)
+	}
+	return terms
+}
+
+// termFrequencies returns the sublinear, field weighted term frequencies of
+// the blog.
+func termFrequencies(blog *Blog) map[string]float64 {
+	counts := make(map[string]float64)
+	for _, t := range tokenize(blog.Content) {
+		counts[t] += contentWeight
+	}
+	for _, t := range tokenize(blog.Title) {
+		counts[t] += titleWeight
+	}
+	for _, tag := range blog.Tags {
+		for _, t := range tokenize(tag) {
+			counts[t] += tagWeight
+		}
+	}
+
+	for t, c := range counts {
+		counts[t] = 1 + math.Log(c)
+	}
+	return counts
+}
+
+// Put indexes the blog, replacing its previous version if any.
+func (idx *termIndex) Put(blog *Blog) {
+	tf := termFrequencies(blog)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(blog.ID)
+	idx.docs[blog.ID] = tf
+	idx.tenants[blog.ID] = blog.TenantID
+	for t := range tf {
+		if idx.postings[t] == nil {
+			idx.postings[t] = make(map[primitive.ObjectID]struct{})
+		}
+		idx.postings[t][blog.ID] = struct{}{}
+	}
+}
+
+// Remove drops the blog from the index.
+func (idx *termIndex) Remove(id primitive.ObjectID) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+}
+
+func (idx *termIndex) remove(id primitive.ObjectID) {
+	for t := range idx.docs[id] {
+		delete(idx.postings[t], id)
+		if len(idx.postings[t]) == 0 {
+			delete(idx.postings, t)
+		}
+	}
+	delete(idx.docs, id)
+	delete(idx.tenants, id)
+}
+
+// idf is the smoothed inverse document frequency of the term. Callers must
+// hold the lock.
+func (idx *termIndex) idf(term string) float64 {
+	return math.Log(1 + float64(len(idx.docs))/float64(1+len(idx.postings[term])))
+}
+
+// norm is the length of the TF-IDF vector of tf. Callers must hold the lock.
+func (idx *termIndex) norm(tf map[string]float64) float64 {
+	var sum float64
+	for t, f := range tf {
+		w := f * idx.idf(t)
+		sum += w * w
+	}
+	return math.Sqrt(sum)
+}
+
+// scoredID is a blog id with its similarity to another blog.
+type scoredID struct {
+	ID    primitive.ObjectID
+	Score float64
+}
+
+// Related returns up to limit blogs of the tenant most similar to the given
+// one, best first. It reports false when the blog isn't indexed for the tenant.
+func (idx *termIndex) Related(tenant string, id primitive.ObjectID, limit int) ([]scoredID, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	query, ok := idx.docs[id]
+	if !ok || idx.tenants[id] != tenant {
+		return nil, false
+	}
+	queryNorm := idx.norm(query)
+	if queryNorm == 0 {
+		return nil, true
+	}
+
+	// Only blogs sharing at least one term can have a positive similarity
+	dots := make(map[primitive.ObjectID]float64)
+	for t, f := range query {
+		idf := idx.idf(t)
+		for candidate := range idx.postings[t] {
+			if candidate != id && idx.tenants[candidate] == tenant {
+				dots[candidate] += f * idf * idx.docs[candidate][t] * idf
+			}
+		}
+	}
+
+	scored := make([]scoredID, 0, len(dots))
+	for candidate, dot := range dots {
+		if n := idx.norm(idx.docs[candidate]); n > 0 && dot > 0 {
+			scored = append(scored, scoredID{ID: candidate, Score: dot / (queryNorm * n)})
+		}
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].Score != scored[j].Score {
+			return scored[i].Score > scored[j].Score
+		}
+		return scored[i].ID.Hex() < scored[j].ID.Hex()
+	})
+
+	if len(scored) > limit {
+		scored = scored[:limit]
+	}
+	return scored, true
+}
+
+// loadRelatedIndex indexes every stored blog.
+func loadRelatedIndex(ctx context.Context) error {
+	cursor, err := collection.Find(ctx, bson.D{},
+		options.Find().SetProjection(bson.M{"tenant_id": 1, "title": 1, "content": 1, "tags": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		data := &Blog{}
+		if err := cursor.Decode(data); err != nil {
+			return err
+		}
+		relatedIndex.Put(data)
+		count++
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	log.Printf("Indexed %d blogs for related posts\n", count)
+	return nil
+}
+
+func (s server) GetRelatedBlogs(ctx context.Context, req *blogpb.GetRelatedBlogsRequest) (*blogpb.GetRelatedBlogsResponse, error) {
+	log.Println("GetRelatedBlogs RPC called...")
+
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		log.Printf("Error parsing id: %v\n", err)
+		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Error parsing id: %v", err))
+	}
+
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultRelatedLimit
+	}
+	if limit > maxRelatedLimit {
+		limit = maxRelatedLimit
+	}
+
+	scored, ok := relatedIndex.Related(tenantFromContext(ctx), oid, limit)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, fmt.Sprintf("Blog not found: %s", oid.Hex()))
+	}
+	if len(scored) == 0 {
+		return &blogpb.GetRelatedBlogsResponse{}, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(scored))
+	for i, s := range scored {
+		ids[i] = s.ID
+	}
+	cursor, err := collection.Find(ctx, approvedFilter(tenantFilter(ctx, bson.M{"_id": bson.M{"$in": ids}})))
+	if err != nil {
+		log.Printf("Error finding the blogs: %v\n", err)
+		return nil, storageError(ctx, "Error finding the blogs", err)
+	}
+	var blogs []*Blog
+	if err := cursor.All(ctx, &blogs); err != nil {
+		log.Printf("Error decoding data: %v\n", err)
+		return nil, storageError(ctx, "Error decoding data", err)
+	}
+
+	byID := make(map[primitive.ObjectID]*Blog, len(blogs))
+	for _, b := range blogs {
+		byID[b.ID] = b
+	}
+
+	// Keep the similarity order, skipping blogs deleted in the meantime or
+	// held by moderation
+	res := &blogpb.GetRelatedBlogsResponse{}
+	for _, s := range scored {
+		if b, ok := byID[s.ID]; ok {
+			res.Related = append(res.Related, &blogpb.RelatedBlog{
+				Blog:  blogToPb(b),
+				Score: s.Score,
+			})
+		}
+	}
+	return res, nil
+}
@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -14,50 +20,90 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/yurianxdev/grpc-course/blog/blogpb"
 )
 
 type server struct{}
 
-func (s server) ListBlog(_ *blogpb.ListBlogRequest, stream blogpb.BlogService_ListBlogServer) error {
+// listBatchSize caps how many blogs a ListBlog cursor buffers at once, so a
+// slow client holds at most one batch in memory.
+const listBatchSize = 100
+
+// Trailer keys telling ListBlog clients how many blogs were sent and how
+// many were skipped because they couldn't be decoded.
+const (
+	sentCountTrailer    = "x-sent-count"
+	skippedCountTrailer = "x-skipped-count"
+)
+
+func (s server) ListBlog(req *blogpb.ListBlogRequest, stream blogpb.BlogService_ListBlogServer) error {
 	log.Println("ListBlog RPC called...")
+	ctx := stream.Context()
+
+	findOptions := options.Find().SetBatchSize(listBatchSize)
+	if req.GetOrderBy() == blogpb.ListBlogRequest_POPULARITY {
+		findOptions.SetSort(bson.D{
+			{Key: "reaction_count", Value: -1},
+			{Key: "view_count", Value: -1},
+			{Key: "_id", Value: -1},
+		})
+	}
 
-	// Find all the collection cause it nil argument
-	cursor, err := collection.Find(context.Background(), bson.D{})
+	var sent, skipped int
+	// Report the counts however the stream ends, so clients can tell a
+	// partial listing from a complete one
+	defer func() {
+		stream.SetTrailer(metadata.Pairs(
+			sentCountTrailer, strconv.Itoa(sent),
+			skippedCountTrailer, strconv.Itoa(skipped),
+		))
+	}()
+
+	cursor, err := collection.Find(ctx, approvedFilter(tenantFilter(ctx, bson.M{})), findOptions)
 	if err != nil {
 		log.Printf("Error finding the blogs: %v\n", err)
-		return status.Errorf(codes.Internal, fmt.Sprintf("Error finding the blogs: %v", err))
+		return storageError(ctx, "Error finding the blogs", err)
 	}
-	defer cursor.Close(context.Background())
+	defer func() {
+		// Kill the server side cursor even when the client went away
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = cursor.Close(closeCtx)
+	}()
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		data := &Blog{}
-		err := cursor.Decode(data)
-		if err != nil {
+		if err := cursor.Decode(data); err != nil {
 			log.Printf("Error decoding data: %v\n", err)
-			return status.Errorf(codes.Internal, fmt.Sprintf("Error decoding data: %v", err))
+			skipped++
+			continue
 		}
 
-		err = stream.Send(&blogpb.ListBlogResponse{
-			Blog: &blogpb.Blog{
-				Id:       data.ID.Hex(),
-				AuthorId: data.AuthorID,
-				Title:    data.Title,
-				Content:  data.Content,
-			},
+		err := stream.Send(&blogpb.ListBlogResponse{
+			Blog: blogToPb(data),
 		})
-
 		if err != nil {
-			log.Printf("Error sending %v data: %v\n", data, err)
+			log.Printf("Error sending %v data: %v\n", data.ID.Hex(), err)
+			return err
 		}
+		sent++
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Error reading the blogs after %d sent: %v\n", sent, err)
+		return storageError(ctx, fmt.Sprintf("Error reading the blogs after %d sent", sent), err)
 	}
 
+	if skipped > 0 {
+		log.Printf("Listed %d blogs, skipped %d undecodable ones\n", sent, skipped)
+	}
 	return nil
 }
 
-func (s server) DeleteBlog(_ context.Context, req *blogpb.DeleteBlogRequest) (*blogpb.DeleteBlogResponse, error) {
+func (s server) DeleteBlog(ctx context.Context, req *blogpb.DeleteBlogRequest) (*blogpb.DeleteBlogResponse, error) {
 	log.Println("DeleteBlog RPC called...")
 
 	blogId := req.GetBlogId()
@@ -68,24 +114,43 @@ func (s server) DeleteBlog(_ context.Context, req *blogpb.DeleteBlogRequest) (*b
 		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Error parsing id: %v", err))
 	}
 
-	filter := bson.M{"_id": oid} // Mongo formatted filter
-	deleteRes, err := collection.DeleteOne(context.Background(), filter)
+	filter := tenantFilter(ctx, bson.M{"_id": oid}) // Mongo formatted filter
+	// Keep the deleted document for the audit log
+	deleted := &Blog{}
+	err = withTransaction(ctx, func(ctx context.Context) error {
+		if err := collection.FindOneAndDelete(ctx, filter).Decode(deleted); err != nil {
+			return err
+		}
+		if err := writeOutbox(ctx, blogDeletedEvent, deleted); err != nil {
+			return err
+		}
+		return recordAudit(ctx, oid, deleted, nil)
+	})
+	if err == mongo.ErrNoDocuments {
+		log.Printf("Blog not found: %v\n", err)
+		return nil, status.Errorf(codes.NotFound, fmt.Sprintf("Blog not found: %v", err))
+	}
 	if err != nil {
 		log.Printf("Error deleting blog: %v\n", err)
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("Error deleting blog: %v", err))
+		return nil, storageError(ctx, "Error deleting blog", err)
 	}
-	if deleteRes.DeletedCount == 0 {
-		log.Printf("Blog not found: %v\n", err)
-		return nil, status.Errorf(codes.NotFound, fmt.Sprintf("Blog not found: %v", err))
+	// Reactions and attachments are meaningless without their blog
+	if _, err := reactionsCollection.DeleteMany(ctx, bson.M{"blog_id": oid}); err != nil {
+		log.Printf("Error deleting reactions of blog %s: %v\n", blogId, err)
+	}
+	if err := deleteBlogAttachments(ctx, oid); err != nil {
+		log.Printf("Error deleting attachments of blog %s: %v\n", blogId, err)
 	}
 
-	log.Printf("Removed %d elements: %s\n", deleteRes.DeletedCount, blogId)
+	relatedIndex.Remove(oid)
+
+	log.Printf("Removed blog: %s\n", blogId)
 	return &blogpb.DeleteBlogResponse{
 		BlogId: blogId,
 	}, nil
 }
 
-func (s server) UpdateBlog(_ context.Context, req *blogpb.UpdateBlogRequest) (*blogpb.UpdateBlogResponse, error) {
+func (s server) UpdateBlog(ctx context.Context, req *blogpb.UpdateBlogRequest) (*blogpb.UpdateBlogResponse, error) {
 	log.Println("UpdateBlog RPC called...")
 
 	blog := req.GetBlog()
@@ -95,30 +160,92 @@ func (s server) UpdateBlog(_ context.Context, req *blogpb.UpdateBlogRequest) (*b
 		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Error parsing id: %v", err))
 	}
 
-	filter := bson.M{"_id": oid} // Mongo formatted filter
-	blogObject := Blog{
-		AuthorID: blog.AuthorId,
-		Title:    blog.Title,
-		Content:  blog.Content,
+	filter := tenantFilter(ctx, bson.M{"_id": oid}) // Mongo formatted filter
+	// Snapshot for the audit log
+	before := &Blog{}
+	err = collection.FindOne(ctx, filter).Decode(before)
+	if err == mongo.ErrNoDocuments && req.GetAllowMissing() {
+		created, err := createBlog(ctx, oid, blog)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Blog created on update: %v\n", oid.Hex())
+		return &blogpb.UpdateBlogResponse{
+			Blog:    blogToPb(created),
+			Created: true,
+		}, nil
 	}
+	if err != nil {
+		log.Printf("Error finding blog: %v\n", err)
+		return nil, findError(ctx, "Error finding blog", err)
+	}
+
+	after := *before
+	after.AuthorID = blog.AuthorId
+	after.Title = blog.Title
+	after.Content = blog.Content
+	after.Tags = normalizeTags(blog.Tags)
+	after.Slug = slugify(blog.Title)
+	after.UpdatedAt = time.Now().UTC()
 
-	updateRes, err := collection.ReplaceOne(context.Background(), filter, &blogObject)
+	if err := moderate(ctx, &after, before); err != nil {
+		return nil, err
+	}
+	// Set only the editable fields so created_at survives the update
+	update := bson.M{"$set": bson.M{
+		"author_id":  after.AuthorID,
+		"title":      after.Title,
+		"content":    after.Content,
+		"tags":       after.Tags,
+		"slug":       after.Slug,
+		"updated_at": after.UpdatedAt,
+
+		"moderation_status": after.ModerationStatus,
+		"moderation_reason": after.ModerationReason,
+	}}
+
+	var updateRes *mongo.UpdateResult
+	err = withTransaction(ctx, func(ctx context.Context) error {
+		// Charged first, so it is enforced even without transactions
+		if err := consumeWriteQuota(ctx, after.AuthorID); err != nil {
+			return err
+		}
+		res, err := collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		// Matched but unmodified still means the blog exists. Failing
+		// rolls back the quota.
+		if updateRes = res; res.MatchedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		if err := writeOutbox(ctx, blogUpdatedEvent, &after); err != nil {
+			return err
+		}
+		return recordAudit(ctx, oid, before, &after)
+	})
+	if err == mongo.ErrNoDocuments {
+		// Deleted since it was read
+		log.Printf("Blog not found: %v\n", oid.Hex())
+		return nil, status.Errorf(codes.NotFound, fmt.Sprintf("Blog not found: %v", oid.Hex()))
+	}
+	if status.Code(err) == codes.ResourceExhausted {
+		return nil, err
+	}
 	if err != nil {
 		log.Printf("Error updating blog: %v\n", err)
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("Error updating blog: %v", err))
-	}
-	if updateRes.ModifiedCount == 0 {
-		log.Printf("Blog not found: %v\n", err)
-		return nil, status.Errorf(codes.NotFound, fmt.Sprintf("Blog not found: %v", err))
+		return nil, storageError(ctx, "Error updating blog", err)
 	}
 
-	log.Printf("Updated %d elements: %v\n", updateRes.ModifiedCount, updateRes.UpsertedID)
+	relatedIndex.Put(&after)
+
+	log.Printf("Updated %d elements: %v\n", updateRes.ModifiedCount, oid.Hex())
 	return &blogpb.UpdateBlogResponse{
-		Blog: blog,
+		Blog: blogToPb(&after),
 	}, nil
 }
 
-func (s server) ReadBlog(_ context.Context, req *blogpb.ReadBlogRequest) (*blogpb.ReadBlogResponse, error) {
+func (s server) ReadBlog(ctx context.Context, req *blogpb.ReadBlogRequest) (*blogpb.ReadBlogResponse, error) {
 	log.Println("ReadBlog RPC called...")
 
 	blogId := req.GetBlogId()
@@ -129,79 +256,307 @@ func (s server) ReadBlog(_ context.Context, req *blogpb.ReadBlogRequest) (*blogp
 		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Error parsing id: %v", err))
 	}
 
-	blog := &Blog{}              // Object model to parse in
-	filter := bson.M{"_id": oid} // Mongo formatted filter
+	blog := &Blog{}                                 // Object model to parse in
+	filter := tenantFilter(ctx, bson.M{"_id": oid}) // Mongo formatted filter
 
-	dbResult := collection.FindOne(context.Background(), filter)
+	dbResult := collection.FindOne(ctx, filter)
 	// Decode response into Golang native object of type Blog
 	if err := dbResult.Decode(blog); err != nil {
 		log.Printf("Error finding blog: %v\n", err)
-		return nil, status.Errorf(codes.NotFound, fmt.Sprintf("Error finding blog: %v", err))
+		return nil, findError(ctx, "Error finding blog", err)
+	}
+	if !canReadBlog(ctx, blog) {
+		log.Printf("Blog not approved: %v\n", blog.ID.Hex())
+		return nil, status.Errorf(codes.NotFound, fmt.Sprintf("Blog not found: %v", blogId))
+	}
+
+	counted, err := recordView(ctx, oid, viewerFromContext(ctx))
+	if err != nil {
+		// A missed view must not fail the read
+		log.Printf("Error recording view: %v\n", err)
+	}
+	if counted {
+		blog.ViewCount++
 	}
 
 	log.Printf("Blog found: %v\n", blog.ID.Hex())
 	return &blogpb.ReadBlogResponse{
-		Blog: &blogpb.Blog{
-			Id:       blog.ID.Hex(),
-			AuthorId: blog.AuthorID,
-			Title:    blog.Title,
-			Content:  blog.Content,
-		},
+		Blog: blogToPb(blog),
 	}, nil
 }
 
-func (s server) CreateBlog(_ context.Context, req *blogpb.CreateBlogRequest) (*blogpb.CreateBlogResponse, error) {
+func (s server) CreateBlog(ctx context.Context, req *blogpb.CreateBlogRequest) (*blogpb.CreateBlogResponse, error) {
 	log.Println("CreateBlog RPC called...")
 	data := req.GetBlog()
-	blog := Blog{
-		AuthorID: data.GetAuthorId(),
-		Title:    data.GetTitle(),
-		Content:  data.GetContent(),
-	}
 
-	result, err := collection.InsertOne(context.Background(), blog)
-	if err != nil {
-		log.Printf("Error inserting blog on collection: %v\n", err)
-		// Return error throw gRPC
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("Internal error: %v", err))
+	// Chosen here so the transaction can be retried without duplicates
+	oid := primitive.NewObjectID()
+	if data.GetId() != "" {
+		id, err := primitive.ObjectIDFromHex(data.GetId())
+		if err != nil {
+			log.Printf("Error parsing id: %v\n", err)
+			return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Error parsing id: %v", err))
+		}
+		oid = id
 	}
 
-	oid, ok := result.InsertedID.(primitive.ObjectID)
-	if !ok {
-		log.Printf("Error getting OID: %v\n", err)
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("Cannot conver to OID: %v", err))
+	blog, err := createBlog(ctx, oid, data)
+	if err != nil {
+		return nil, err
 	}
 
 	log.Printf("Blog created: %v\n", oid.Hex())
 	return &blogpb.CreateBlogResponse{
-		Blog: &blogpb.Blog{
-			Id:       oid.Hex(),
-			AuthorId: blog.AuthorID,
-			Title:    blog.Title,
-			Content:  blog.Content,
-		},
+		Blog: blogToPb(blog),
 	}, nil
 }
 
+// createBlog stores a new blog with the given id, failing with AlreadyExists
+// when the id is taken.
+func createBlog(ctx context.Context, oid primitive.ObjectID, data *blogpb.Blog) (*Blog, error) {
+	now := time.Now().UTC()
+	blog := &Blog{
+		ID:        oid,
+		TenantID:  tenantFromContext(ctx),
+		AuthorID:  data.GetAuthorId(),
+		Title:     data.GetTitle(),
+		Content:   data.GetContent(),
+		Tags:      normalizeTags(data.GetTags()),
+		Slug:      slugify(data.GetTitle()),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := moderate(ctx, blog, nil); err != nil {
+		return nil, err
+	}
+	err := withTransaction(ctx, func(ctx context.Context) error {
+		// Charged first, so it is enforced even without transactions
+		if err := consumeWriteQuota(ctx, blog.AuthorID); err != nil {
+			return err
+		}
+		if _, err := collection.InsertOne(ctx, blog); err != nil {
+			return err
+		}
+		if err := writeOutbox(ctx, blogCreatedEvent, blog); err != nil {
+			return err
+		}
+		return recordAudit(ctx, oid, nil, blog)
+	})
+	if isDuplicateKeyError(err) {
+		return nil, status.Errorf(codes.AlreadyExists, fmt.Sprintf("Blog %s already exists", oid.Hex()))
+	}
+	if status.Code(err) == codes.ResourceExhausted {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("Error inserting blog on collection: %v\n", err)
+		// Return error throw gRPC
+		return nil, storageError(ctx, "Error inserting blog", err)
+	}
+
+	relatedIndex.Put(blog)
+	return blog, nil
+}
+
 type Blog struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty"`
-	AuthorID string             `bson:"author_id"`
-	Title    string             `bson:"title"`
-	Content  string             `bson:"content"`
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	TenantID  string             `bson:"tenant_id"`
+	AuthorID  string             `bson:"author_id"`
+	Title     string             `bson:"title"`
+	Content   string             `bson:"content"`
+	Tags      []string           `bson:"tags"`
+	Slug      string             `bson:"slug"`
+	CreatedAt time.Time          `bson:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at"`
+
+	ViewCount     int64            `bson:"view_count"`
+	ReactionCount int64            `bson:"reaction_count"`
+	Reactions     map[string]int64 `bson:"reactions,omitempty"`
+
+	ModerationStatus string `bson:"moderation_status,omitempty"`
+	ModerationReason string `bson:"moderation_reason,omitempty"`
+}
+
+// blogToPb converts the stored blog into its protocol buffer representation.
+func blogToPb(data *Blog) *blogpb.Blog {
+	return &blogpb.Blog{
+		Id:            data.ID.Hex(),
+		AuthorId:      data.AuthorID,
+		Title:         data.Title,
+		Content:       data.Content,
+		ViewCount:     data.ViewCount,
+		ReactionCount: data.ReactionCount,
+		Reactions:     data.Reactions,
+		Tags:          data.Tags,
+		Slug:          data.Slug,
+		CreatedAt:     timestamppb.New(data.CreatedAt),
+		UpdatedAt:     timestamppb.New(data.UpdatedAt),
+
+		ModerationStatus: moderationStatusToPb(data.ModerationStatus),
+		ModerationReason: data.ModerationReason,
+	}
+}
+
+// moderationStatusToPb converts the stored moderation status. Blogs stored
+// before moderation existed have none and are approved.
+func moderationStatusToPb(s string) blogpb.ModerationStatus {
+	if s == "" {
+		return blogpb.ModerationStatus_APPROVED
+	}
+	return blogpb.ModerationStatus(blogpb.ModerationStatus_value[s])
+}
+
+// slugify turns a title into a lowercase, dash separated URL segment.
+func slugify(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// normalizeTag makes tag comparisons case and whitespace insensitive.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// normalizeTags normalizes every tag, dropping empty and repeated ones.
+func normalizeTags(tags []string) []string {
+	normalized := []string{}
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
 }
 
 var collection *mongo.Collection
 
+// storageError converts a failed storage operation into a status, telling
+// apart the requests that were canceled or ran out of time.
+func storageError(ctx context.Context, msg string, err error) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return status.Errorf(codes.DeadlineExceeded, fmt.Sprintf("%s: %v", msg, ctx.Err()))
+	case context.Canceled:
+		return status.Errorf(codes.Canceled, fmt.Sprintf("%s: %v", msg, ctx.Err()))
+	}
+	return status.Errorf(codes.Internal, fmt.Sprintf("%s: %v", msg, err))
+}
+
+// findError converts the error of a lookup, failing with NotFound when no
+// document matched.
+func findError(ctx context.Context, msg string, err error) error {
+	if err == mongo.ErrNoDocuments {
+		return status.Errorf(codes.NotFound, fmt.Sprintf("%s: %v", msg, err))
+	}
+	return storageError(ctx, msg, err)
+}
+
+// storageTimeout is the deadline given to unary requests sent without one,
+// so a stuck database doesn't pile up requests forever. Zero disables it.
+var storageTimeout = 10 * time.Second
+
+func deadlineUnaryInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if _, ok := ctx.Deadline(); !ok && storageTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, storageTimeout)
+		defer cancel()
+	}
+	return handler(ctx, req)
+}
+
+// isDuplicateKeyError reports whether err was caused by a unique index violation.
+func isDuplicateKeyError(err error) bool {
+	const duplicateKeyCode = 11000
+
+	switch e := err.(type) {
+	case mongo.WriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == duplicateKeyCode {
+				return true
+			}
+		}
+	case mongo.BulkWriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == duplicateKeyCode {
+				return true
+			}
+		}
+	case mongo.CommandError:
+		return e.Code == duplicateKeyCode
+	}
+	return false
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	port := "50051"
-	log.Println("Starting server...")
-	// Listen tcp connections
-	li, err := net.Listen("tcp", ":"+port)
+	httpAddr := flag.String("http-addr", ":8080", "address of the HTTP server for feeds and sitemap")
+	flag.StringVar(&siteURL, "site-url", siteURL, "public base URL used in feed and sitemap links")
+	tokensFile := flag.String("tokens-file", "", "file of \"<token> <principal> [tenant]\" lines accepted as bearer tokens")
+	adminList := flag.String("admins", "", "comma separated principals allowed to call admin RPCs")
+	webhooksFile := flag.String("webhooks-file", "", "file of \"<url> <secret>\" lines receiving blog events")
+	moderationFile := flag.String("moderation", "", "JSON file configuring the moderation of blog writes")
+	rateLimitsFile := flag.String("rate-limits", "", "JSON file of per-method rate limits and the daily write quota")
+	flag.DurationVar(&storageTimeout, "storage-timeout", storageTimeout, "deadline of requests sent without one, 0 to disable")
+	statsMode := flag.String("stats", "aggregate", "how GetBlogStats is computed: aggregate in the database, or scan the blogs for databases without $facet")
+	flag.Parse()
+
+	if *tokensFile != "" {
+		loaded, err := loadTokens(*tokensFile)
+		if err != nil {
+			log.Fatalf("Failed loading tokens: %v\n", err)
+		}
+		tokens = loaded
+	}
+	for _, admin := range strings.Split(*adminList, ",") {
+		if admin = strings.TrimSpace(admin); admin != "" {
+			admins[admin] = true
+		}
+	}
+	limits := defaultRateLimits
+	if *rateLimitsFile != "" {
+		loaded, err := loadRateLimits(*rateLimitsFile)
+		if err != nil {
+			log.Fatalf("Failed loading rate limits: %v\n", err)
+		}
+		limits = loaded
+	}
+	dailyWriteQuota = limits.DailyWriteQuota
+	moderationRules := defaultModeration
+	if *moderationFile != "" {
+		loaded, err := loadModeration(*moderationFile)
+		if err != nil {
+			log.Fatalf("Failed loading moderation: %v\n", err)
+		}
+		moderationRules = loaded
+	}
+	pipeline, err := moderationRules.pipeline()
 	if err != nil {
-		log.Fatalf("Error listening server: %v", err)
+		log.Fatalf("Failed loading moderation: %v\n", err)
+	}
+	moderation = pipeline
+	computer, ok := statsComputers[*statsMode]
+	if !ok {
+		log.Fatalf("Unknown -stats %q, use aggregate or scan\n", *statsMode)
 	}
+	blogStats = computer
 
 	// MongoDB client
 	log.Printf("Connecting to database client on port %s...", "27017")
@@ -215,12 +570,73 @@ func main() {
 	}
 
 	// Create database or connection
-	collection = client.Database("mydb").Collection("blog")
+	mongoClient = client
+	db := client.Database("mydb")
+	collection = db.Collection("blog")
+	reactionsCollection = db.Collection("blog_reactions")
+	viewsCollection = db.Collection("blog_views")
+	auditCollection = db.Collection("audit_events")
+	outboxCollection = db.Collection("outbox")
+	tenantsCollection = db.Collection("tenants")
+	quotasCollection = db.Collection("write_quotas")
+	attachmentsDB = db
+
+	// Bring indexes and documents up to the current schema
+	if err := runMigrations(context.TODO(), db); err != nil {
+		_ = client.Disconnect(context.TODO())
+		log.Fatalf("Failed migrating database: %v\n", err)
+	}
+	// "blog_server migrate" only applies the migrations
+	if flag.Arg(0) == "migrate" {
+		_ = client.Disconnect(context.TODO())
+		return
+	}
+
+	// Term index for related blogs
+	if err := loadRelatedIndex(context.TODO()); err != nil {
+		_ = client.Disconnect(context.TODO())
+		log.Fatalf("Failed indexing blogs: %v\n", err)
+	}
+
+	transactionsSupported, err = detectTransactions(context.TODO(), db)
+	if err != nil {
+		log.Fatalf("Failed inspecting database: %v\n", err)
+	}
+	if !transactionsSupported {
+		log.Println("Database doesn't support transactions, outbox events are written separately")
+	}
 
-	// Create new server
-	s := grpc.NewServer()
+	// Deliver outbox events to the webhooks in the background
+	var endpoints []webhookEndpoint
+	if *webhooksFile != "" {
+		if endpoints, err = loadWebhooks(*webhooksFile); err != nil {
+			log.Fatalf("Failed loading webhooks: %v\n", err)
+		}
+	}
+	dispatcherCtx, stopDispatcher := context.WithCancel(context.Background())
+	dispatcherDone := make(chan struct{})
+	go func() {
+		newWebhookDispatcher(db, endpoints).Run(dispatcherCtx)
+		close(dispatcherDone)
+	}()
+
+	port := "50051"
+	log.Println("Starting server...")
+	// Listen tcp connections
+	li, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Fatalf("Error listening server: %v", err)
+	}
+
+	// Create new server, rate limiting clients once they are authenticated
+	limiter := newRateLimiter(limits)
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(deadlineUnaryInterceptor, authUnaryInterceptor, limiter.unaryInterceptor, tenantUnaryInterceptor),
+		grpc.ChainStreamInterceptor(authStreamInterceptor, limiter.streamInterceptor, tenantStreamInterceptor),
+	)
 	// Append implementations of methods defined on
 	blogpb.RegisterBlogServiceServer(s, &server{})
+	blogpb.RegisterAttachmentServiceServer(s, &attachmentServer{})
 
 	go func() {
 		log.Printf("Server listening on port %s", port)
@@ -230,14 +646,28 @@ func main() {
 		}
 	}()
 
+	// Serve feeds and sitemap over plain HTTP
+	httpServer := &http.Server{Addr: *httpAddr, Handler: feedHandler()}
+	go func() {
+		log.Printf("HTTP server listening on %s", *httpAddr)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Error serving HTTP: %v", err)
+		}
+	}()
+
 	// Wait for control c to exit
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, os.Interrupt)
 
 	// Exit gracefully
 	<-ch
+	log.Printf("Stopping the webhook dispatcher...\n")
+	stopDispatcher()
+	<-dispatcherDone
 	log.Printf("Stopping the database client...\n")
 	_ = client.Disconnect(context.TODO())
+	log.Printf("Stopping the HTTP server...\n")
+	_ = httpServer.Shutdown(context.TODO())
 	log.Printf("Stopping the server...\n")
 	s.Stop()
 	log.Printf("Closing the listener...\n")
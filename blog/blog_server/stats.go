@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurianxdev/grpc-course/blog/blogpb"
+)
+
+const (
+	defaultStatsTop = 10
+	maxStatsTop     = 100
+)
+
+// histogramFormats are the $dateToString formats of every histogram bucket.
+var histogramFormats = map[blogpb.GetBlogStatsRequest_Bucket]string{
+	blogpb.GetBlogStatsRequest_MONTH: "%Y-%m",
+	blogpb.GetBlogStatsRequest_WEEK:  "%G-W%V",
+	blogpb.GetBlogStatsRequest_DAY:   "%Y-%m-%d",
+}
+
+// statsQuery selects the blogs the statistics are computed on.
+type statsQuery struct {
+	// Filter matches the blogs, already scoped to the tenant and the
+	// approved blogs
+	Filter bson.M
+	// Top bounds the number of authors and tags returned
+	Top    int
+	Bucket blogpb.GetBlogStatsRequest_Bucket
+}
+
+// statsComputer computes the statistics of the blogs matching a query.
+type statsComputer interface {
+	Stats(ctx context.Context, q statsQuery) (*blogpb.GetBlogStatsResponse, error)
+}
+
+// blogStats computes the statistics of GetBlogStats, in the store when it
+// supports the aggregation pipeline.
+var blogStats statsComputer = aggregationStats{}
+
+// statsComputers are the choices of the -stats flag.
+var statsComputers = map[string]statsComputer{
+	"aggregate": aggregationStats{},
+	"scan":      scanStats{},
+}
+
+// statCount is a group of the stats aggregation.
+type statCount struct {
+	Key   string `bson:"_id"`
+	Count int64  `bson:"count"`
+}
+
+// aggregatedStats is the single document returned by the stats aggregation.
+type aggregatedStats struct {
+	Totals []struct {
+		Count         int64   `bson:"count"`
+		AverageLength float64 `bson:"average_length"`
+	} `bson:"totals"`
+	PerAuthor []statCount `bson:"per_author"`
+	PerTag    []statCount `bson:"per_tag"`
+	Histogram []statCount `bson:"histogram"`
+}
+
+// statsPipeline computes every statistic of the matching blogs in a single
+// pass, one $facet per statistic.
+func statsPipeline(match bson.M, top int, format string) mongo.Pipeline {
+	byCount := bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}
+	count := bson.M{"$sum": 1}
+
+	return mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$facet", Value: bson.M{
+			"totals": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":            nil,
+					"count":          count,
+					"average_length": bson.M{"$avg": bson.M{"$strLenCP": bson.M{"$ifNull": bson.A{"$content", ""}}}},
+				}},
+			},
+			"per_author": bson.A{
+				bson.M{"$group": bson.M{"_id": "$author_id", "count": count}},
+				bson.M{"$sort": byCount},
+				bson.M{"$limit": top},
+			},
+			"per_tag": bson.A{
+				bson.M{"$unwind": "$tags"},
+				bson.M{"$group": bson.M{"_id": "$tags", "count": count}},
+				bson.M{"$sort": byCount},
+				bson.M{"$limit": top},
+			},
+			"histogram": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":   bson.M{"$dateToString": bson.M{"format": format, "date": "$created_at"}},
+					"count": count,
+				}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+		}}},
+	}
+}
+
+func toStatCounts(counts []statCount) []*blogpb.StatCount {
+	res := make([]*blogpb.StatCount, len(counts))
+	for i, c := range counts {
+		res[i] = &blogpb.StatCount{Key: c.Key, Count: c.Count}
+	}
+	return res
+}
+
+func (s server) GetBlogStats(ctx context.Context, req *blogpb.GetBlogStatsRequest) (*blogpb.GetBlogStatsResponse, error) {
+	log.Println("GetBlogStats RPC called...")
+
+	if _, ok := histogramFormats[req.GetBucket()]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Invalid bucket: %v", req.GetBucket()))
+	}
+
+	top := int(req.GetTop())
+	if top <= 0 {
+		top = defaultStatsTop
+	}
+	if top > maxStatsTop {
+		top = maxStatsTop
+	}
+
+	match := approvedFilter(tenantFilter(ctx, bson.M{}))
+	if req.GetAuthorId() != "" {
+		match["author_id"] = req.GetAuthorId()
+	}
+	if req.GetTag() != "" {
+		match["tags"] = normalizeTag(req.GetTag())
+	}
+	createdAt := bson.M{}
+	if req.GetSince() != nil {
+		createdAt["$gte"] = req.GetSince().AsTime()
+	}
+	if req.GetUntil() != nil {
+		createdAt["$lt"] = req.GetUntil().AsTime()
+	}
+	if len(createdAt) > 0 {
+		match["created_at"] = createdAt
+	}
+
+	res, err := blogStats.Stats(ctx, statsQuery{Filter: match, Top: top, Bucket: req.GetBucket()})
+	if err != nil {
+		log.Printf("Error computing stats: %v\n", err)
+		return nil, storageError(ctx, "Error computing stats", err)
+	}
+	return res, nil
+}
+
+// aggregationStats computes the statistics in the store with statsPipeline.
+type aggregationStats struct{}
+
+func (aggregationStats) Stats(ctx context.Context, q statsQuery) (*blogpb.GetBlogStatsResponse, error) {
+	cursor, err := collection.Aggregate(ctx, statsPipeline(q.Filter, q.Top, histogramFormats[q.Bucket]))
+	if err != nil {
+		return nil, err
+	}
+	var results []aggregatedStats
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	res := &blogpb.GetBlogStatsResponse{}
+	if len(results) == 0 {
+		return res, nil
+	}
+	stats := results[0]
+	if len(stats.Totals) > 0 {
+		res.TotalBlogs = stats.Totals[0].Count
+		res.AverageContentLength = stats.Totals[0].AverageLength
+	}
+	res.PerAuthor = toStatCounts(stats.PerAuthor)
+	res.PerTag = toStatCounts(stats.PerTag)
+	res.CreatedHistogram = toStatCounts(stats.Histogram)
+	return res, nil
+}
+
+// scanStats computes the statistics in memory while reading the matching
+// blogs, for the stores lacking $facet or $dateToString. It reads every
+// matching blog, so it is only suited to small collections.
+type scanStats struct{}
+
+func (scanStats) Stats(ctx context.Context, q statsQuery) (*blogpb.GetBlogStatsResponse, error) {
+	cursor, err := collection.Find(ctx, q.Filter, options.Find().SetProjection(bson.M{
+		"author_id":  1,
+		"content":    1,
+		"tags":       1,
+		"created_at": 1,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	acc := newStatsAccumulator(q.Bucket)
+	for cursor.Next(ctx) {
+		blog := &Blog{}
+		if err := cursor.Decode(blog); err != nil {
+			return nil, err
+		}
+		acc.add(blog)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return acc.result(q.Top), nil
+}
+
+// statsAccumulator computes the statistics of the aggregation pipeline on
+// the blogs added to it.
+type statsAccumulator struct {
+	bucket    blogpb.GetBlogStatsRequest_Bucket
+	count     int64
+	length    int64
+	perAuthor map[string]int64
+	perTag    map[string]int64
+	histogram map[string]int64
+}
+
+func newStatsAccumulator(bucket blogpb.GetBlogStatsRequest_Bucket) *statsAccumulator {
+	return &statsAccumulator{
+		bucket:    bucket,
+		perAuthor: make(map[string]int64),
+		perTag:    make(map[string]int64),
+		histogram: make(map[string]int64),
+	}
+}
+
+func (a *statsAccumulator) add(blog *Blog) {
+	a.count++
+	// $strLenCP counts code points
+	a.length += int64(utf8.RuneCountInString(blog.Content))
+	a.perAuthor[blog.AuthorID]++
+	for _, tag := range blog.Tags {
+		a.perTag[tag]++
+	}
+	a.histogram[histogramKey(a.bucket, blog.CreatedAt)]++
+}
+
+func (a *statsAccumulator) result(top int) *blogpb.GetBlogStatsResponse {
+	res := &blogpb.GetBlogStatsResponse{TotalBlogs: a.count}
+	if a.count == 0 {
+		return res
+	}
+	res.AverageContentLength = float64(a.length) / float64(a.count)
+	res.PerAuthor = topStatCounts(a.perAuthor, top)
+	res.PerTag = topStatCounts(a.perTag, top)
+
+	res.CreatedHistogram = make([]*blogpb.StatCount, 0, len(a.histogram))
+	for key, count := range a.histogram {
+		res.CreatedHistogram = append(res.CreatedHistogram, &blogpb.StatCount{Key: key, Count: count})
+	}
+	sort.Slice(res.CreatedHistogram, func(i, j int) bool {
+		return res.CreatedHistogram[i].Key < res.CreatedHistogram[j].Key
+	})
+	return res
+}
+
+// histogramKey formats t like $dateToString with the format of the bucket.
+func histogramKey(bucket blogpb.GetBlogStatsRequest_Bucket, t time.Time) string {
+	t = t.UTC()
+	switch bucket {
+	case blogpb.GetBlogStatsRequest_WEEK:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case blogpb.GetBlogStatsRequest_DAY:
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01")
+}
+
+// topStatCounts sorts the counts like the pipeline, most first then by key,
+// and keeps the top ones.
+func topStatCounts(counts map[string]int64, top int) []*blogpb.StatCount {
+	res := make([]*blogpb.StatCount, 0, len(counts))
+	for key, count := range counts {
+		res = append(res, &blogpb.StatCount{Key: key, Count: count})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Key < res[j].Key
+	})
+	if len(res) > top {
+		res = res[:top]
+	}
+	return res
+}
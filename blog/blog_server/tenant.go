@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/yurianxdev/grpc-course/blog/blogpb"
+)
+
+// defaultTenant owns the data of requests not naming a tenant. It always
+// exists and can't be deleted.
+const defaultTenant = "default"
+
+// tenantMetadataKey is the request metadata selecting the tenant.
+const tenantMetadataKey = "x-tenant-id"
+
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Tenant is a namespace isolating the blogs of a team.
+type Tenant struct {
+	Name        string    `bson:"_id"`
+	DisplayName string    `bson:"display_name"`
+	CreatedAt   time.Time `bson:"created_at"`
+}
+
+func (t *Tenant) toPb() *blogpb.Tenant {
+	return &blogpb.Tenant{
+		Name:        t.Name,
+		DisplayName: t.DisplayName,
+		CreatedAt:   timestamppb.New(t.CreatedAt),
+	}
+}
+
+var tenantsCollection *mongo.Collection
+
+type tenantKey struct{}
+
+// resolveTenant picks the tenant of the request from its metadata or, when
+// the principal is restricted to one, from the principal. Only admins can
+// access a tenant other than their own, so anonymous requests and principals
+// bound to no tenant are limited to the default one.
+func resolveTenant(ctx context.Context) (context.Context, error) {
+	var requested string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(tenantMetadataKey); len(values) > 0 {
+		requested = values[0]
+	}
+	bound := principalTenantFromContext(ctx)
+
+	tenant := defaultTenant
+	if bound != "" {
+		tenant = bound
+	}
+	if requested != "" && requested != tenant {
+		if !isAdmin(ctx) {
+			return nil, status.Errorf(codes.PermissionDenied, fmt.Sprintf("%s can't access tenant %s", principalFromContext(ctx), requested))
+		}
+		tenant = requested
+	}
+
+	if tenant != defaultTenant {
+		err := tenantsCollection.FindOne(ctx, bson.M{"_id": tenant}).Err()
+		if err == mongo.ErrNoDocuments {
+			return nil, status.Errorf(codes.NotFound, fmt.Sprintf("Unknown tenant: %s", tenant))
+		}
+		if err != nil {
+			log.Printf("Error finding tenant: %v\n", err)
+			return nil, storageError(ctx, "Error finding tenant", err)
+		}
+	}
+
+	return context.WithValue(ctx, tenantKey{}, tenant), nil
+}
+
+// tenantFromContext returns the tenant the request operates on.
+func tenantFromContext(ctx context.Context) string {
+	if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+		return tenant
+	}
+	return defaultTenant
+}
+
+// tenantFilter scopes a blog filter to the tenant of the request.
+func tenantFilter(ctx context.Context, filter bson.M) bson.M {
+	filter["tenant_id"] = tenantFromContext(ctx)
+	return filter
+}
+
+func tenantUnaryInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := resolveTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func tenantStreamInterceptor(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := resolveTenant(stream.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+}
+
+func (s server) CreateTenant(ctx context.Context, req *blogpb.CreateTenantRequest) (*blogpb.CreateTenantResponse, error) {
+	log.Println("CreateTenant RPC called...")
+
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	name := req.GetTenant().GetName()
+	if !tenantNamePattern.MatchString(name) {
+		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Invalid tenant name %q, use lowercase letters, digits and dashes", name))
+	}
+	if name == defaultTenant {
+		return nil, status.Errorf(codes.AlreadyExists, fmt.Sprintf("Tenant already exists: %s", name))
+	}
+
+	tenant := &Tenant{
+		Name:        name,
+		DisplayName: req.GetTenant().GetDisplayName(),
+		CreatedAt:   time.Now().UTC(),
+	}
+	if _, err := tenantsCollection.InsertOne(ctx, tenant); err != nil {
+		if isDuplicateKeyError(err) {
+			return nil, status.Errorf(codes.AlreadyExists, fmt.Sprintf("Tenant already exists: %s", name))
+		}
+		log.Printf("Error inserting tenant: %v\n", err)
+		return nil, storageError(ctx, "Error inserting tenant", err)
+	}
+
+	log.Printf("Tenant created: %s\n", name)
+	return &blogpb.CreateTenantResponse{
+		Tenant: tenant.toPb(),
+	}, nil
+}
+
+func (s server) ListTenants(ctx context.Context, _ *blogpb.ListTenantsRequest) (*blogpb.ListTenantsResponse, error) {
+	log.Println("ListTenants RPC called...")
+
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	cursor, err := tenantsCollection.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		log.Printf("Error finding tenants: %v\n", err)
+		return nil, storageError(ctx, "Error finding tenants", err)
+	}
+	var tenants []*Tenant
+	if err := cursor.All(ctx, &tenants); err != nil {
+		log.Printf("Error decoding data: %v\n", err)
+		return nil, storageError(ctx, "Error decoding data", err)
+	}
+
+	res := &blogpb.ListTenantsResponse{
+		Tenants: []*blogpb.Tenant{{Name: defaultTenant}},
+	}
+	for _, t := range tenants {
+		res.Tenants = append(res.Tenants, t.toPb())
+	}
+	return res, nil
+}
+
+func (s server) DeleteTenant(ctx context.Context, req *blogpb.DeleteTenantRequest) (*blogpb.DeleteTenantResponse, error) {
+	log.Println("DeleteTenant RPC called...")
+
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	name := req.GetName()
+	if name == defaultTenant {
+		return nil, status.Errorf(codes.FailedPrecondition, "The default tenant can't be deleted")
+	}
+
+	// Remove the tenant first so no new blogs are created while cleaning up
+	deleteRes, err := tenantsCollection.DeleteOne(ctx, bson.M{"_id": name})
+	if err != nil {
+		log.Printf("Error deleting tenant: %v\n", err)
+		return nil, storageError(ctx, "Error deleting tenant", err)
+	}
+	if deleteRes.DeletedCount == 0 {
+		return nil, status.Errorf(codes.NotFound, fmt.Sprintf("Unknown tenant: %s", name))
+	}
+
+	deleted, err := deleteTenantBlogs(ctx, name)
+	if err != nil {
+		log.Printf("Error deleting blogs of tenant %s: %v\n", name, err)
+		return nil, storageError(ctx, fmt.Sprintf("Error deleting blogs of tenant %s", name), err)
+	}
+
+	log.Printf("Tenant deleted: %s (%d blogs)\n", name, deleted)
+	return &blogpb.DeleteTenantResponse{
+		Name:         name,
+		DeletedBlogs: deleted,
+	}, nil
+}
+
+// deleteTenantBlogs removes the blogs of the tenant with their reactions,
+// views, attachments and write quotas. Every blog is deleted like with
+// DeleteBlog, so the deletions are audited and sent to the webhooks. The
+// audit events of the tenant are kept, they are only readable by admins.
+func deleteTenantBlogs(ctx context.Context, tenant string) (int64, error) {
+	cursor, err := collection.Find(ctx, bson.M{"tenant_id": tenant}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var blogs []*Blog
+	if err := cursor.All(ctx, &blogs); err != nil {
+		return 0, err
+	}
+
+	// The events are recorded in the tenant of the blogs, not of the admin
+	ctx = context.WithValue(ctx, tenantKey{}, tenant)
+	var deleted int64
+	for _, b := range blogs {
+		err := withTransaction(ctx, func(ctx context.Context) error {
+			before := &Blog{}
+			if err := collection.FindOneAndDelete(ctx, bson.M{"_id": b.ID, "tenant_id": tenant}).Decode(before); err != nil {
+				return err
+			}
+			if err := writeOutbox(ctx, blogDeletedEvent, before); err != nil {
+				return err
+			}
+			return recordAudit(ctx, b.ID, before, nil)
+		})
+		if err == mongo.ErrNoDocuments {
+			// Deleted concurrently
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+		deleted++
+
+		if _, err := reactionsCollection.DeleteMany(ctx, bson.M{"blog_id": b.ID}); err != nil {
+			return deleted, err
+		}
+		if _, err := viewsCollection.DeleteMany(ctx, bson.M{"blog_id": b.ID}); err != nil {
+			return deleted, err
+		}
+		if err := deleteBlogAttachments(ctx, b.ID); err != nil {
+			return deleted, err
+		}
+		relatedIndex.Remove(b.ID)
+	}
+
+	if _, err := quotasCollection.DeleteMany(ctx, bson.M{"tenant_id": tenant}); err != nil {
+		return deleted, err
+	}
+	return deleted, nil
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// webhookEndpoint is an HTTP receiver of blog events. Every request is signed
+// with its secret.
+type webhookEndpoint struct {
+	URL    string
+	Secret string
+}
+
+// loadWebhooks reads a file of "<url> <secret>" lines. Blank lines and lines
+// starting with # are ignored.
+func loadWebhooks(path string) ([]webhookEndpoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var endpoints []webhookEndpoint
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<url> <secret>\"", path, line)
+		}
+		if u, err := url.Parse(fields[0]); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("%s:%d: invalid URL %q", path, line, fields[0])
+		}
+		endpoints = append(endpoints, webhookEndpoint{URL: fields[0], Secret: fields[1]})
+	}
+	return endpoints, scanner.Err()
+}
+
+// webhookDelivery is the delivery of one outbox event to one endpoint.
+type webhookDelivery struct {
+	ID            string    `bson:"_id"`
+	EventType     string    `bson:"event_type"`
+	Endpoint      string    `bson:"endpoint"`
+	Payload       []byte    `bson:"payload"`
+	Attempts      int       `bson:"attempts"`
+	NextAttemptAt time.Time `bson:"next_attempt_at"`
+	LastError     string    `bson:"last_error,omitempty"`
+	CreatedAt     time.Time `bson:"created_at"`
+}
+
+// webhookPayload is the JSON body posted to the endpoints.
+type webhookPayload struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Tenant     string          `json:"tenant"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Blog       json.RawMessage `json:"blog"`
+}
+
+// webhookDispatcher moves outbox events into per endpoint deliveries and
+// posts them, retrying failures with exponential backoff until they are
+// moved to the dead letters.
+type webhookDispatcher struct {
+	Endpoints []webhookEndpoint
+	Client    *http.Client
+
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	PollInterval time.Duration
+	// Lease is how long a claimed delivery is hidden from other dispatchers
+	Lease time.Duration
+
+	Outbox      *mongo.Collection
+	Deliveries  *mongo.Collection
+	DeadLetters *mongo.Collection
+}
+
+func newWebhookDispatcher(db *mongo.Database, endpoints []webhookEndpoint) *webhookDispatcher {
+	return &webhookDispatcher{
+		Endpoints:    endpoints,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts:  8,
+		BaseBackoff:  time.Second,
+		MaxBackoff:   10 * time.Minute,
+		PollInterval: time.Second,
+		Lease:        time.Minute,
+		Outbox:       db.Collection("outbox"),
+		Deliveries:   db.Collection("webhook_deliveries"),
+		DeadLetters:  db.Collection("webhook_dead_letters"),
+	}
+}
+
+// Run dispatches events until ctx is done.
+func (d *webhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.fanOut(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error dispatching outbox events: %v\n", err)
+		}
+		if err := d.deliverDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error delivering webhooks: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fanOut creates a delivery per endpoint for every undispatched event, then
+// marks the event as dispatched. Deliveries have deterministic ids, so a
+// crash between both steps doesn't duplicate them.
+func (d *webhookDispatcher) fanOut(ctx context.Context) error {
+	cursor, err := d.Outbox.Find(ctx, bson.M{"dispatched": false},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(100))
+	if err != nil {
+		return err
+	}
+	var events []*OutboxEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		payload, err := d.payload(event)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		for _, endpoint := range d.Endpoints {
+			_, err := d.Deliveries.InsertOne(ctx, webhookDelivery{
+				ID:            event.ID.Hex() + " " + endpoint.URL,
+				EventType:     event.Type,
+				Endpoint:      endpoint.URL,
+				Payload:       payload,
+				NextAttemptAt: now,
+				CreatedAt:     now,
+			})
+			if err != nil && !isDuplicateKeyError(err) {
+				return err
+			}
+		}
+
+		_, err = d.Outbox.UpdateOne(ctx, bson.M{"_id": event.ID},
+			bson.M{"$set": bson.M{"dispatched": true, "dispatched_at": now}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *webhookDispatcher) payload(event *OutboxEvent) ([]byte, error) {
+	blog, err := protojson.Marshal(blogToPb(event.Blog))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(webhookPayload{
+		ID:         event.ID.Hex(),
+		Type:       event.Type,
+		Tenant:     event.Blog.TenantID,
+		OccurredAt: event.CreatedAt,
+		Blog:       blog,
+	})
+}
+
+// deliverDue claims and posts every delivery whose next attempt is due.
+func (d *webhookDispatcher) deliverDue(ctx context.Context) error {
+	for ctx.Err() == nil {
+		now := time.Now().UTC()
+		delivery := &webhookDelivery{}
+		err := d.Deliveries.FindOneAndUpdate(ctx,
+			bson.M{"next_attempt_at": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"next_attempt_at": now.Add(d.Lease)}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}),
+		).Decode(delivery)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := d.attempt(ctx, delivery); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// attempt posts the delivery and records the outcome.
+func (d *webhookDispatcher) attempt(ctx context.Context, delivery *webhookDelivery) error {
+	endpoint, ok := d.endpoint(delivery.Endpoint)
+	if !ok {
+		// The endpoint was unregistered since the delivery was created
+		_, err := d.Deliveries.DeleteOne(ctx, bson.M{"_id": delivery.ID})
+		return err
+	}
+
+	postErr := d.post(ctx, endpoint, delivery)
+	if postErr == nil {
+		_, err := d.Deliveries.DeleteOne(ctx, bson.M{"_id": delivery.ID})
+		return err
+	}
+
+	if d.failed(delivery, postErr, time.Now().UTC()) {
+		log.Printf("Webhook delivery %s dead after %d attempts: %v\n", delivery.ID, delivery.Attempts, postErr)
+		if _, err := d.DeadLetters.InsertOne(ctx, delivery); err != nil && !isDuplicateKeyError(err) {
+			return err
+		}
+		_, err := d.Deliveries.DeleteOne(ctx, bson.M{"_id": delivery.ID})
+		return err
+	}
+
+	log.Printf("Webhook delivery %s failed (attempt %d): %v\n", delivery.ID, delivery.Attempts, postErr)
+	_, err := d.Deliveries.UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{"$set": bson.M{
+		"attempts":        delivery.Attempts,
+		"last_error":      delivery.LastError,
+		"next_attempt_at": delivery.NextAttemptAt,
+	}})
+	return err
+}
+
+// failed records a failed attempt of the delivery and schedules the next
+// one. It reports whether the delivery ran out of attempts instead.
+func (d *webhookDispatcher) failed(delivery *webhookDelivery, postErr error, now time.Time) bool {
+	delivery.Attempts++
+	delivery.LastError = postErr.Error()
+	if delivery.Attempts >= d.MaxAttempts {
+		return true
+	}
+	delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+	return false
+}
+
+func (d *webhookDispatcher) endpoint(u string) (webhookEndpoint, bool) {
+	for _, e := range d.Endpoints {
+		if e.URL == u {
+			return e, true
+		}
+	}
+	return webhookEndpoint{}, false
+}
+
+// backoff is the delay before the next attempt after the given number of
+// failed ones: exponential, capped and with up to 20% of jitter.
+func (d *webhookDispatcher) backoff(attempts int) time.Duration {
+	delay := d.MaxBackoff
+	if attempts < 32 {
+		if exp := d.BaseBackoff << uint(attempts-1); exp > 0 && exp < d.MaxBackoff {
+			delay = exp
+		}
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// post sends the delivery to the endpoint. The signature header holds the
+// hex HMAC-SHA256, keyed by the endpoint secret, of "<timestamp>.<body>".
+func (d *webhookDispatcher) post(ctx context.Context, endpoint webhookEndpoint, delivery *webhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Blog-Event", delivery.EventType)
+	req.Header.Set("X-Blog-Delivery", delivery.ID)
+	req.Header.Set("X-Blog-Timestamp", timestamp)
+	req.Header.Set("X-Blog-Signature", "sha256="+signWebhook(endpoint.Secret, timestamp, delivery.Payload))
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%s responded %s", endpoint.URL, res.Status)
+	}
+	return nil
+}
+
+// signWebhook computes the signature receivers use to authenticate a body.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
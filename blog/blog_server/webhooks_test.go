@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// webhookReceiver records the requests posted to it, answering with the
+// queued status codes and 200 once they run out.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.requests = append(rcv.requests, r)
+	rcv.bodies = append(rcv.bodies, body)
+	code := http.StatusOK
+	if len(rcv.statuses) > 0 {
+		code, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+	}
+	w.WriteHeader(code)
+}
+
+func newTestDispatcher(endpoint webhookEndpoint) *webhookDispatcher {
+	return &webhookDispatcher{
+		Endpoints:   []webhookEndpoint{endpoint},
+		Client:      &http.Client{Timeout: 5 * time.Second},
+		MaxAttempts: 3,
+		BaseBackoff: time.Second,
+		MaxBackoff:  time.Minute,
+	}
+}
+
+func newTestDelivery(t *testing.T, d *webhookDispatcher, endpoint webhookEndpoint) *webhookDelivery {
+	now := time.Now().UTC()
+	event := &OutboxEvent{
+		ID:   primitive.NewObjectID(),
+		Type: blogCreatedEvent,
+		Blog: &Blog{
+			ID:        primitive.NewObjectID(),
+			TenantID:  "acme",
+			AuthorID:  "ana",
+			Title:     "Hello webhooks",
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		CreatedAt: now,
+	}
+	payload, err := d.payload(event)
+	if err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+	return &webhookDelivery{
+		ID:            event.ID.Hex() + " " + endpoint.URL,
+		EventType:     event.Type,
+		Endpoint:      endpoint.URL,
+		Payload:       payload,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+}
+
+func TestWebhookPostIsSigned(t *testing.T) {
+	rcv := &webhookReceiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	endpoint := webhookEndpoint{URL: srv.URL, Secret: "s3cret"}
+	d := newTestDispatcher(endpoint)
+	delivery := newTestDelivery(t, d, endpoint)
+
+	if err := d.post(context.Background(), endpoint, delivery); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	if len(rcv.requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(rcv.requests))
+	}
+
+	req, body := rcv.requests[0], rcv.bodies[0]
+	if got := req.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if got := req.Header.Get("X-Blog-Event"); got != blogCreatedEvent {
+		t.Errorf("X-Blog-Event = %q, want %q", got, blogCreatedEvent)
+	}
+	if got := req.Header.Get("X-Blog-Delivery"); got != delivery.ID {
+		t.Errorf("X-Blog-Delivery = %q, want %q", got, delivery.ID)
+	}
+
+	// Verified the way a receiver would, independently of signWebhook
+	mac := hmac.New(sha256.New, []byte(endpoint.Secret))
+	mac.Write([]byte(req.Header.Get("X-Blog-Timestamp") + "."))
+	mac.Write(body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := req.Header.Get("X-Blog-Signature"); !hmac.Equal([]byte(got), []byte(want)) {
+		t.Errorf("X-Blog-Signature = %q, want %q", got, want)
+	}
+
+	var payload struct {
+		ID     string `json:"id"`
+		Type   string `json:"type"`
+		Tenant string `json:"tenant"`
+		Blog   struct {
+			Title    string `json:"title"`
+			AuthorID string `json:"authorId"`
+		} `json:"blog"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("decoding payload %s: %v", body, err)
+	}
+	if payload.ID != strings.Fields(delivery.ID)[0] || payload.Type != blogCreatedEvent || payload.Tenant != "acme" {
+		t.Errorf("payload = %+v, want event %s of type %s in tenant acme", payload, delivery.ID, blogCreatedEvent)
+	}
+	if payload.Blog.Title != "Hello webhooks" || payload.Blog.AuthorID != "ana" {
+		t.Errorf("payload blog = %+v, want the blog of the event", payload.Blog)
+	}
+}
+
+func TestWebhookFailedDeliveryIsRetried(t *testing.T) {
+	rcv := &webhookReceiver{statuses: []int{http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	endpoint := webhookEndpoint{URL: srv.URL, Secret: "s3cret"}
+	d := newTestDispatcher(endpoint)
+	delivery := newTestDelivery(t, d, endpoint)
+
+	postErr := d.post(context.Background(), endpoint, delivery)
+	if postErr == nil {
+		t.Fatal("post succeeded on a 503")
+	}
+	now := time.Now().UTC()
+	if dead := d.failed(delivery, postErr, now); dead {
+		t.Fatal("delivery dead after the first attempt")
+	}
+	if delivery.Attempts != 1 || !strings.Contains(delivery.LastError, "503") {
+		t.Errorf("attempts = %d, last error = %q, want 1 and the 503", delivery.Attempts, delivery.LastError)
+	}
+	// The base backoff plus up to 20% of jitter
+	if wait := delivery.NextAttemptAt.Sub(now); wait < d.BaseBackoff || wait > d.BaseBackoff*6/5 {
+		t.Errorf("next attempt in %v, want the base backoff of %v", wait, d.BaseBackoff)
+	}
+
+	if err := d.post(context.Background(), endpoint, delivery); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if len(rcv.requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(rcv.requests))
+	}
+	if got := rcv.requests[1].Header.Get("X-Blog-Delivery"); got != delivery.ID {
+		t.Errorf("retry X-Blog-Delivery = %q, want %q", got, delivery.ID)
+	}
+	if string(rcv.bodies[1]) != string(rcv.bodies[0]) {
+		t.Errorf("retry posted %s, want the same payload %s", rcv.bodies[1], rcv.bodies[0])
+	}
+}
+
+func TestWebhookDeliveryDeadAfterMaxAttempts(t *testing.T) {
+	d := newTestDispatcher(webhookEndpoint{URL: "http://localhost", Secret: "s3cret"})
+	delivery := &webhookDelivery{ID: "event http://localhost"}
+	postErr := errors.New("connection refused")
+
+	now := time.Now().UTC()
+	for i := 1; i < d.MaxAttempts; i++ {
+		if d.failed(delivery, postErr, now) {
+			t.Fatalf("delivery dead after %d attempts, want %d", i, d.MaxAttempts)
+		}
+	}
+	if !d.failed(delivery, postErr, now) {
+		t.Fatalf("delivery still retried after %d attempts", delivery.Attempts)
+	}
+}
+
+func TestWebhookBackoffIsCapped(t *testing.T) {
+	d := newTestDispatcher(webhookEndpoint{})
+	for _, attempts := range []int{10, 31, 32, 100} {
+		if got := d.backoff(attempts); got < d.MaxBackoff || got > d.MaxBackoff*6/5 {
+			t.Errorf("backoff(%d) = %v, want the max backoff of %v", attempts, got, d.MaxBackoff)
+		}
+	}
+}
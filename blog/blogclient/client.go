@@ -0,0 +1,217 @@
+// Package blogclient is a client of the BlogService, taking care of the
+// credentials, tenant, timeouts and retries of the calls and mapping their
+// failures to errors matchable with errors.Is.
+package blogclient
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/yurianxdev/grpc-course/blog/blogpb"
+)
+
+// Client calls the BlogService over a single connection. It is safe for
+// concurrent use.
+type Client struct {
+	conn  *grpc.ClientConn
+	blogs blogpb.BlogServiceClient
+	opts  options
+}
+
+// New connects to the blog server. The connection is established lazily,
+// the first call failing when the server can't be reached.
+func New(opts ...Option) (*Client, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	dialOptions := []grpc.DialOption{grpc.WithInsecure()}
+	if o.tls != nil || o.caFile != "" {
+		creds := credentials.NewTLS(o.tls)
+		if o.caFile != "" {
+			var err error
+			if creds, err = credentials.NewClientTLSFromFile(o.caFile, ""); err != nil {
+				return nil, err
+			}
+		}
+		dialOptions = []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	}
+	if o.token != "" {
+		dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(bearerToken(o.token)))
+	}
+	if o.tenant != "" {
+		dialOptions = append(dialOptions,
+			grpc.WithChainUnaryInterceptor(tenantUnaryInterceptor(o.tenant)),
+			grpc.WithChainStreamInterceptor(tenantStreamInterceptor(o.tenant)),
+		)
+	}
+	dialOptions = append(dialOptions, o.dialOptions...)
+
+	conn, err := grpc.Dial(o.address, dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, blogs: blogpb.NewBlogServiceClient(conn), opts: o}, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Service returns the generated client, for the calls this package doesn't
+// wrap. Its calls send the token and tenant but aren't bounded by the
+// timeout nor retried.
+func (c *Client) Service() blogpb.BlogServiceClient {
+	return c.blogs
+}
+
+// bearerToken sends the token of every call. It is allowed over insecure
+// connections, as the local servers run without TLS.
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (bearerToken) RequireTransportSecurity() bool {
+	return false
+}
+
+func tenantUnaryInterceptor(tenant string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-tenant-id", tenant)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func tenantStreamInterceptor(tenant string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-tenant-id", tenant)
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// withTimeout bounds ctx by the timeout, unless it already has a deadline.
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || c.opts.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.opts.timeout)
+}
+
+// call runs fn within the timeout, retrying it on the transient failures.
+func (c *Client) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	backoff := c.opts.backoff
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= c.opts.retries || !retryable(err) {
+			return wrapError(err)
+		}
+		if !sleep(ctx, backoff) {
+			return wrapError(err)
+		}
+		backoff *= 2
+	}
+}
+
+// sleep waits for d, returning false when ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// CreateBlog creates blog and returns it as stored. ErrConflict is matched
+// when a blog has its id already.
+//
+// An empty id is generated before the first attempt, so the retries of a
+// create processed by the server don't create the blog twice.
+func (c *Client) CreateBlog(ctx context.Context, blog *blogpb.Blog) (*blogpb.Blog, error) {
+	generated := blog.GetId() == ""
+	if generated {
+		blog = proto.Clone(blog).(*blogpb.Blog)
+		blog.Id = primitive.NewObjectID().Hex()
+	}
+
+	var res *blogpb.CreateBlogResponse
+	attempts := 0
+	err := c.call(ctx, func(ctx context.Context) (err error) {
+		attempts++
+		res, err = c.blogs.CreateBlog(ctx, &blogpb.CreateBlogRequest{Blog: blog})
+		return err
+	})
+	if generated && attempts > 1 && status.Code(err) == codes.AlreadyExists {
+		// A previous attempt created it, the response was lost
+		if created, readErr := c.ReadBlog(ctx, blog.GetId()); readErr == nil {
+			return created, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res.GetBlog(), nil
+}
+
+// ReadBlog returns the blog with the id, counting a view from the principal
+// of the token, or from the peer address without one.
+func (c *Client) ReadBlog(ctx context.Context, id string) (*blogpb.Blog, error) {
+	var res *blogpb.ReadBlogResponse
+	err := c.call(ctx, func(ctx context.Context) (err error) {
+		res, err = c.blogs.ReadBlog(ctx, &blogpb.ReadBlogRequest{BlogId: id})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.GetBlog(), nil
+}
+
+// UpdateBlog replaces the fields of the blog with the id of blog.
+func (c *Client) UpdateBlog(ctx context.Context, blog *blogpb.Blog) (*blogpb.Blog, error) {
+	updated, _, err := c.updateBlog(ctx, blog, false)
+	return updated, err
+}
+
+// UpsertBlog replaces the fields of the blog with the id of blog, creating
+// it when it doesn't exist. created reports whether it did.
+func (c *Client) UpsertBlog(ctx context.Context, blog *blogpb.Blog) (updated *blogpb.Blog, created bool, err error) {
+	return c.updateBlog(ctx, blog, true)
+}
+
+func (c *Client) updateBlog(ctx context.Context, blog *blogpb.Blog, allowMissing bool) (*blogpb.Blog, bool, error) {
+	var res *blogpb.UpdateBlogResponse
+	err := c.call(ctx, func(ctx context.Context) (err error) {
+		res, err = c.blogs.UpdateBlog(ctx, &blogpb.UpdateBlogRequest{Blog: blog, AllowMissing: allowMissing})
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return res.GetBlog(), res.GetCreated(), nil
+}
+
+// DeleteBlog deletes the blog with the id.
+func (c *Client) DeleteBlog(ctx context.Context, id string) error {
+	return c.call(ctx, func(ctx context.Context) error {
+		_, err := c.blogs.DeleteBlog(ctx, &blogpb.DeleteBlogRequest{BlogId: id})
+		return err
+	})
+}
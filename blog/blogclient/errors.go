@@ -0,0 +1,95 @@
+package blogclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The errors the failures of the calls can be matched against with
+// errors.Is.
+var (
+	// ErrNotFound is matched when the blog doesn't exist
+	ErrNotFound = errors.New("blogclient: not found")
+	// ErrConflict is matched when the blog already exists, or the call
+	// raced with another one or doesn't apply to the current state
+	ErrConflict = errors.New("blogclient: conflict")
+	// ErrInvalidArgument is matched when the request is malformed or the
+	// content was rejected by moderation
+	ErrInvalidArgument = errors.New("blogclient: invalid argument")
+	// ErrPermissionDenied is matched when the token is missing, invalid or
+	// not allowed to make the call
+	ErrPermissionDenied = errors.New("blogclient: permission denied")
+	// ErrRateLimited is matched when a rate limit or quota is exhausted
+	ErrRateLimited = errors.New("blogclient: rate limited")
+)
+
+// Error is the failure of a call, carrying the status returned by the
+// server. status.FromError and status.Code accept it.
+type Error struct {
+	status *status.Status
+	kind   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.status.Code(), e.status.Message())
+}
+
+// Unwrap returns the error among the ones of this package matching the
+// code, or the context error for DeadlineExceeded and Canceled.
+func (e *Error) Unwrap() error {
+	return e.kind
+}
+
+// Code returns the gRPC code of the failure.
+func (e *Error) Code() codes.Code {
+	return e.status.Code()
+}
+
+// GRPCStatus returns the status returned by the server.
+func (e *Error) GRPCStatus() *status.Status {
+	return e.status
+}
+
+// wrapError turns the gRPC errors into *Error, leaving the others as is.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	e := &Error{status: st}
+	switch st.Code() {
+	case codes.NotFound:
+		e.kind = ErrNotFound
+	case codes.AlreadyExists, codes.Aborted, codes.FailedPrecondition:
+		e.kind = ErrConflict
+	case codes.InvalidArgument:
+		e.kind = ErrInvalidArgument
+	case codes.PermissionDenied, codes.Unauthenticated:
+		e.kind = ErrPermissionDenied
+	case codes.ResourceExhausted:
+		e.kind = ErrRateLimited
+	case codes.DeadlineExceeded:
+		e.kind = context.DeadlineExceeded
+	case codes.Canceled:
+		e.kind = context.Canceled
+	}
+	return e
+}
+
+// retryable reports whether a call failing with err may succeed when made
+// again.
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted:
+		return true
+	}
+	return false
+}
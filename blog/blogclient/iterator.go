@@ -0,0 +1,138 @@
+package blogclient
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/yurianxdev/grpc-course/blog/blogpb"
+)
+
+// BlogIterator walks the blogs streamed by ListBlogs:
+//
+//	it := client.ListBlogs(ctx, blogpb.ListBlogRequest_DEFAULT)
+//	defer it.Close()
+//	for it.Next() {
+//		fmt.Println(it.Blog().GetTitle())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type BlogIterator struct {
+	c      *Client
+	ctx    context.Context
+	cancel context.CancelFunc
+	req    *blogpb.ListBlogRequest
+	stream blogpb.BlogService_ListBlogClient
+
+	blog     *blogpb.Blog
+	received int
+	attempts int
+	backoff  time.Duration
+	done     bool
+	err      error
+}
+
+// ListBlogs lists the blogs in the given order. The listing is bounded by
+// the timeout as a whole, and is retried on transient failures only until
+// the first blog is received.
+func (c *Client) ListBlogs(ctx context.Context, order blogpb.ListBlogRequest_OrderBy) *BlogIterator {
+	ctx, cancel := c.withTimeout(ctx)
+	return &BlogIterator{
+		c:       c,
+		ctx:     ctx,
+		cancel:  cancel,
+		req:     &blogpb.ListBlogRequest{OrderBy: order},
+		backoff: c.opts.backoff,
+	}
+}
+
+// Next advances to the next blog, returning false at the end of the listing
+// or on failure.
+func (it *BlogIterator) Next() bool {
+	if it.done {
+		return false
+	}
+
+	for {
+		if it.stream == nil {
+			stream, err := it.c.blogs.ListBlog(it.ctx, it.req)
+			if err != nil {
+				if it.retry(err) {
+					continue
+				}
+				return it.finish(err)
+			}
+			it.stream = stream
+		}
+
+		res, err := it.stream.Recv()
+		if err == io.EOF {
+			return it.finish(nil)
+		}
+		if err != nil {
+			if it.retry(err) {
+				it.stream = nil
+				continue
+			}
+			return it.finish(err)
+		}
+		it.blog = res.GetBlog()
+		it.received++
+		return true
+	}
+}
+
+// retry reports whether the listing should be started again after failing
+// with err, waiting for the backoff if so.
+func (it *BlogIterator) retry(err error) bool {
+	if it.received > 0 || it.attempts >= it.c.opts.retries || !retryable(err) {
+		return false
+	}
+	if !sleep(it.ctx, it.backoff) {
+		return false
+	}
+	it.attempts++
+	it.backoff *= 2
+	return true
+}
+
+func (it *BlogIterator) finish(err error) bool {
+	it.done = true
+	it.blog = nil
+	it.err = wrapError(err)
+	it.cancel()
+	return false
+}
+
+// Blog returns the current blog.
+func (it *BlogIterator) Blog() *blogpb.Blog {
+	return it.blog
+}
+
+// Err returns the failure that ended the listing, nil when it completed.
+func (it *BlogIterator) Err() error {
+	return it.err
+}
+
+// Skipped returns how many blogs the server couldn't send, known once the
+// listing completed.
+func (it *BlogIterator) Skipped() int {
+	if it.stream == nil || !it.done {
+		return 0
+	}
+	values := it.stream.Trailer().Get("x-skipped-count")
+	if len(values) == 0 {
+		return 0
+	}
+	skipped, _ := strconv.Atoi(values[0])
+	return skipped
+}
+
+// Close stops the listing. It is safe to call at any time.
+func (it *BlogIterator) Close() {
+	if !it.done {
+		it.finish(nil)
+	}
+}
@@ -0,0 +1,94 @@
+package blogclient
+
+import (
+	"crypto/tls"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	defaultAddress = "localhost:50051"
+	defaultTimeout = 10 * time.Second
+	defaultRetries = 3
+	defaultBackoff = 100 * time.Millisecond
+)
+
+type options struct {
+	address     string
+	tls         *tls.Config
+	caFile      string
+	token       string
+	tenant      string
+	timeout     time.Duration
+	retries     int
+	backoff     time.Duration
+	dialOptions []grpc.DialOption
+}
+
+func defaultOptions() options {
+	return options{
+		address: defaultAddress,
+		timeout: defaultTimeout,
+		retries: defaultRetries,
+		backoff: defaultBackoff,
+	}
+}
+
+// Option configures a Client.
+type Option func(*options)
+
+// WithAddress sets the address of the blog server, localhost:50051 by
+// default.
+func WithAddress(addr string) Option {
+	return func(o *options) { o.address = addr }
+}
+
+// WithTLS connects with TLS using config, the system roots when nil. The
+// connection is insecure by default.
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) {
+		if config == nil {
+			config = &tls.Config{}
+		}
+		o.tls = config
+	}
+}
+
+// WithCAFile connects with TLS, verifying the server with the CA of the PEM
+// file.
+func WithCAFile(path string) Option {
+	return func(o *options) { o.caFile = path }
+}
+
+// WithToken sends token as the bearer token of every call.
+func WithToken(token string) Option {
+	return func(o *options) { o.token = token }
+}
+
+// WithTenant operates on tenant, sent as x-tenant-id. The server uses the
+// tenant of the token when empty.
+func WithTenant(tenant string) Option {
+	return func(o *options) { o.tenant = tenant }
+}
+
+// WithTimeout bounds the calls whose context has no deadline, retries
+// included. 10s by default, 0 for none.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// WithRetries sets how many times a call failing with Unavailable or Aborted
+// is retried, waiting backoff and doubling it between attempts. 3 times from
+// 100ms by default, 0 disables the retries.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.retries = retries
+		o.backoff = backoff
+	}
+}
+
+// WithDialOptions adds options to the ones dialing the server.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) { o.dialOptions = append(o.dialOptions, opts...) }
+}
@@ -3,8 +3,11 @@ module github.com/yurianxdev/grpc-course
 go 1.14
 
 require (
+	github.com/chzyer/readline v1.5.1
 	github.com/golang/protobuf v1.4.2
 	go.mongodb.org/mongo-driver v1.4.0
+	golang.org/x/text v0.3.3
+	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013
 	google.golang.org/grpc v1.31.0
 	google.golang.org/protobuf v1.25.0
 )
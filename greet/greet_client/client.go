@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/durationpb"
 
 	"github.com/yurianxdev/grpc-course/greet/greetpb"
 )
@@ -42,6 +43,7 @@ func doBidirectionalStreaming(c greetpb.GreetServiceClient) {
 			Greeting: &greetpb.Greeting{
 				FirstName: "Julian",
 			},
+			Room: "course",
 		},
 		{
 			Greeting: &greetpb.Greeting{
@@ -79,7 +81,7 @@ func doBidirectionalStreaming(c greetpb.GreetServiceClient) {
 				log.Printf("Error while reciving response: %v\n", err)
 				break
 			}
-			fmt.Printf("Recived: %v\n", res.GetResponse())
+			fmt.Printf("Recived %s in %s: %v\n", res.GetKind(), res.GetRoom(), res.GetResponse())
 		}
 		close(wc)
 	}()
@@ -128,6 +130,7 @@ func doClientStreaming(c greetpb.GreetServiceClient) {
 	res, err := stream.CloseAndRecv()
 	if err != nil {
 		log.Printf("Error recieving streams: %v", err)
+		return
 	}
 
 	fmt.Printf("LongGreet response: %v\n", res)
@@ -140,6 +143,8 @@ func doServerStreaming(c greetpb.GreetServiceClient) {
 			FirstName: "Bryan",
 			LastName:  "Rincon",
 		},
+		Count:    5,
+		Interval: durationpb.New(500 * time.Millisecond),
 	}
 
 	resStream, err := c.GreetManyTimes(context.Background(), req)
@@ -156,14 +161,16 @@ func doServerStreaming(c greetpb.GreetServiceClient) {
 		}
 		if err != nil {
 			log.Printf("Error reading stream: %v\n", err)
+			break
 		}
 		fmt.Printf("Response from GreetManyTimes: %s\n", msg.GetResult())
 	}
+	fmt.Printf("Greetings delivered: %v\n", resStream.Trailer().Get("x-delivered-count"))
 }
 
 func doUnary(c greetpb.GreetServiceClient) {
 	log.Println("Starting to do an Unary RPC...")
-	req := &greetpb.GreetRequest{Greeting: &greetpb.Greeting{FirstName: "Julian"}}
+	req := &greetpb.GreetRequest{Greeting: &greetpb.Greeting{FirstName: "Julian", Language: "es"}}
 	res, err := c.Greet(context.Background(), req)
 	if err != nil {
 		log.Printf("Error while calling GreetRPC: %v\n", err)
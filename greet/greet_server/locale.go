@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/language"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurianxdev/grpc-course/greet/greetpb"
+)
+
+// locale holds the greetings of a language.
+type locale struct {
+	tag language.Tag
+	// hello greets a name
+	hello string
+	// numbered greets a name with the number of the greeting
+	numbered string
+	// familyNameFirst writes the last name before the first one
+	familyNameFirst bool
+}
+
+// locales is the catalog of supported languages, English first as the
+// default.
+var locales = []*locale{
+	{tag: language.English, hello: "Hello %s", numbered: "Hello %s, this is the greet number %d"},
+	{tag: language.Spanish, hello: "Hola %s", numbered: "Hola %s, este es el saludo número %d"},
+	{tag: language.French, hello: "Bonjour %s", numbered: "Bonjour %s, ceci est le salut numéro %d"},
+	{tag: language.German, hello: "Hallo %s", numbered: "Hallo %s, das ist der Gruß Nummer %d"},
+	{tag: language.Italian, hello: "Ciao %s", numbered: "Ciao %s, questo è il saluto numero %d"},
+	{tag: language.Portuguese, hello: "Olá %s", numbered: "Olá %s, esta é a saudação número %d"},
+	{tag: language.Dutch, hello: "Hallo %s", numbered: "Hallo %s, dit is groet nummer %d"},
+	{tag: language.Polish, hello: "Cześć %s", numbered: "Cześć %s, to jest powitanie numer %d"},
+	{tag: language.Russian, hello: "Привет, %s", numbered: "Привет, %s, это приветствие номер %d"},
+	{tag: language.Turkish, hello: "Merhaba %s", numbered: "Merhaba %s, bu %d. selamlama"},
+	{tag: language.Hungarian, hello: "Szia %s", numbered: "Szia %s, ez a(z) %d. üdvözlés", familyNameFirst: true},
+	{tag: language.Japanese, hello: "こんにちは、%sさん", numbered: "こんにちは、%sさん、これは%d回目の挨拶です", familyNameFirst: true},
+	{tag: language.Chinese, hello: "你好，%s", numbered: "你好，%s，这是第%d次问候", familyNameFirst: true},
+	{tag: language.Korean, hello: "안녕하세요, %s님", numbered: "안녕하세요, %s님, %d번째 인사입니다", familyNameFirst: true},
+	{tag: language.Vietnamese, hello: "Xin chào %s", numbered: "Xin chào %s, đây là lời chào thứ %d", familyNameFirst: true},
+}
+
+var localeMatcher = func() language.Matcher {
+	tags := make([]language.Tag, len(locales))
+	for i, l := range locales {
+		tags[i] = l.tag
+	}
+	return language.NewMatcher(tags)
+}()
+
+// localeFor returns the locale to greet in: the language of the greeting,
+// else the best match of the accept-language metadata, else English. An
+// unsupported language fails with InvalidArgument.
+func localeFor(ctx context.Context, greeting *greetpb.Greeting) (*locale, error) {
+	if lang := greeting.GetLanguage(); lang != "" {
+		tag, err := language.Parse(lang)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Invalid language %q: %v", lang, err))
+		}
+		l, ok := matchLocale(tag)
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Unsupported language %q", lang))
+		}
+		return l, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := strings.Join(md.Get("accept-language"), ",")
+	if header == "" {
+		return locales[0], nil
+	}
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Invalid accept-language %q: %v", header, err))
+	}
+	// Preferences are a wish, English is used when none is supported
+	for _, tag := range tags {
+		if l, ok := matchLocale(tag); ok {
+			return l, nil
+		}
+	}
+	return locales[0], nil
+}
+
+// matchLocale returns the locale of the language of tag, regardless of its
+// region or script. The matcher alone would fall back on related languages,
+// e.g. English for Swahili.
+func matchLocale(tag language.Tag) (*locale, bool) {
+	_, i, confidence := localeMatcher.Match(tag)
+	base, _ := tag.Base()
+	matched, _ := locales[i].tag.Base()
+	if confidence == language.No || base != matched {
+		return nil, false
+	}
+	return locales[i], true
+}
+
+// name writes the full name of the greeting in the order of the locale.
+func (l *locale) name(greeting *greetpb.Greeting) string {
+	first, last := greeting.GetFirstName(), greeting.GetLastName()
+	switch {
+	case last == "":
+		return first
+	case first == "":
+		return last
+	case l.familyNameFirst:
+		return last + " " + first
+	}
+	return first + " " + last
+}
+
+// greet greets the person of the greeting.
+func (l *locale) greet(greeting *greetpb.Greeting) string {
+	return fmt.Sprintf(l.hello, l.name(greeting))
+}
+
+// greetNumbered greets the person of the greeting for the nth time.
+func (l *locale) greetNumbered(greeting *greetpb.Greeting, n int) string {
+	return fmt.Sprintf(l.numbered, l.name(greeting), n)
+}
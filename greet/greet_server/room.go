@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/yurianxdev/grpc-course/greet/greetpb"
+)
+
+const (
+	// defaultRoom is joined by the streams naming no room
+	defaultRoom = "lobby"
+	// maxRoomName bounds the length of the room names
+	maxRoomName = 64
+	// memberBuffer is how many messages a member may lag behind its room
+	// before being disconnected
+	memberBuffer = 64
+)
+
+// member is a stream connected to a room.
+type member struct {
+	name string
+	room string
+	// out queues the messages to send to the stream
+	out chan *greetpb.GreetEveryOneResponse
+	// kicked is closed when the member is disconnected for being slow
+	kicked chan struct{}
+}
+
+// hub fans out the messages of every room to its members.
+type hub struct {
+	mu    sync.Mutex
+	rooms map[string]map[*member]bool
+}
+
+func newHub() *hub {
+	return &hub{rooms: make(map[string]map[*member]bool)}
+}
+
+// join adds a member to its room, announcing it to everyone there.
+func (h *hub) join(name, room string) *member {
+	m := &member{
+		name:   name,
+		room:   room,
+		out:    make(chan *greetpb.GreetEveryOneResponse, memberBuffer),
+		kicked: make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*member]bool)
+	}
+	h.rooms[room][m] = true
+	h.broadcastLocked(room, &greetpb.GreetEveryOneResponse{
+		Response: fmt.Sprintf("%s joined %s", name, room),
+		Kind:     greetpb.GreetEveryOneResponse_JOINED,
+		Room:     room,
+		Name:     name,
+	})
+	return m
+}
+
+// leave removes a member from its room, announcing it to the others. It
+// does nothing when the member already left.
+func (h *hub) leave(m *member) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.removeLocked(m) {
+		h.broadcastLocked(m.room, leftMessage(m))
+	}
+}
+
+// broadcast sends a message to every member of a room.
+func (h *hub) broadcast(room string, res *greetpb.GreetEveryOneResponse) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.broadcastLocked(room, res)
+}
+
+// broadcastLocked queues the message to every member of the room without
+// blocking. The members whose queue is full are disconnected, so a slow
+// stream doesn't hold up the room, and their leaving is announced too.
+func (h *hub) broadcastLocked(room string, res *greetpb.GreetEveryOneResponse) {
+	pending := []*greetpb.GreetEveryOneResponse{res}
+	for len(pending) > 0 {
+		res, pending = pending[0], pending[1:]
+		for m := range h.rooms[room] {
+			select {
+			case m.out <- res:
+			default:
+				h.removeLocked(m)
+				close(m.kicked)
+				pending = append(pending, leftMessage(m))
+			}
+		}
+	}
+}
+
+func (h *hub) removeLocked(m *member) bool {
+	members := h.rooms[m.room]
+	if !members[m] {
+		return false
+	}
+	delete(members, m)
+	if len(members) == 0 {
+		delete(h.rooms, m.room)
+	}
+	return true
+}
+
+func leftMessage(m *member) *greetpb.GreetEveryOneResponse {
+	return &greetpb.GreetEveryOneResponse{
+		Response: fmt.Sprintf("%s left %s", m.name, m.room),
+		Kind:     greetpb.GreetEveryOneResponse_LEFT,
+		Room:     m.room,
+		Name:     m.name,
+	}
+}
@@ -2,23 +2,47 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"strconv"
+	"strings"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 
 	"github.com/yurianxdev/grpc-course/greet/greetpb"
 )
 
-type server struct{}
+type server struct {
+	hub       *hub
+	templates *templateStore
+}
+
+// senderStopTimeout bounds how long GreetEveryOne waits for its sender to
+// stop once the client is done sending.
+const senderStopTimeout = time.Second
 
 func (s *server) GreetEveryOne(stream greetpb.GreetService_GreetEveryOneServer) error {
 	log.Printf("Request for GreetEveryOne was accepted...\n")
 
-	for {
+	// The room comes from the metadata, else from the first message
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	var first *greetpb.GreetEveryOneRequest
+	var m *member
+	if rooms := md.Get("x-room"); len(rooms) > 0 && rooms[0] != "" {
+		room, err := roomName(rooms[0])
+		if err != nil {
+			return err
+		}
+		m = s.hub.join(memberName(stream, md), room)
+	} else {
 		req, err := stream.Recv()
 		if err == io.EOF {
 			return nil
@@ -26,21 +50,137 @@ func (s *server) GreetEveryOne(stream greetpb.GreetService_GreetEveryOneServer)
 		if err != nil {
 			return err
 		}
+		room, err := roomName(req.GetRoom())
+		if err != nil {
+			return err
+		}
+		l, err := localeFor(stream.Context(), req.GetGreeting())
+		if err != nil {
+			return err
+		}
+		first = req
+		m = s.hub.join(l.name(req.GetGreeting()), room)
+	}
+	defer s.hub.leave(m)
+	log.Printf("%s joined room %s\n", m.name, m.room)
 
-		firstName := req.GetGreeting().GetFirstName()
-		result := "Hello " + firstName + "! "
-		err = stream.Send(&greetpb.GreetEveryOneResponse{
-			Response: result,
-		})
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- s.readGreetings(stream, m, first)
+	}()
+	done := make(chan struct{})
+	sendErr := make(chan error, 1)
+	go func() {
+		sendErr <- sendGreetings(stream, m, done)
+	}()
+	// The sender is stopped and waited for before returning, but only for
+	// a while: blocked in Send on a client not reading, it only returns
+	// once the handler does and the stream is cancelled
+	stopSending := func() {
+		close(done)
+		select {
+		case <-sendErr:
+		case <-stream.Context().Done():
+		case <-time.After(senderStopTimeout):
+		}
+	}
+
+	select {
+	case err := <-readErr:
+		stopSending()
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	case err := <-sendErr:
+		return err
+	case <-m.kicked:
+		// The sender is most likely blocked on the slow client, returning
+		// cancels the stream and unblocks it
+		close(done)
+		log.Printf("%s disconnected from room %s for being slow\n", m.name, m.room)
+		return status.Errorf(codes.ResourceExhausted, fmt.Sprintf("Disconnected from room %s for not keeping up", m.room))
+	}
+}
+
+// roomName validates the room a stream joins.
+func roomName(room string) (string, error) {
+	if room == "" {
+		return defaultRoom, nil
+	}
+	if len(room) > maxRoomName {
+		return "", status.Errorf(codes.InvalidArgument, fmt.Sprintf("Room name longer than %d bytes", maxRoomName))
+	}
+	return room, nil
+}
+
+// memberName names a stream joining through the metadata, before any
+// greeting: the x-name metadata, else the peer address.
+func memberName(stream greetpb.GreetService_GreetEveryOneServer, md metadata.MD) string {
+	if names := md.Get("x-name"); len(names) > 0 && names[0] != "" {
+		return names[0]
+	}
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		return p.Addr.String()
+	}
+	return "anonymous"
+}
+
+// readGreetings broadcasts the greetings of the stream to its room, starting
+// with first when set, until the stream ends.
+func (s *server) readGreetings(stream greetpb.GreetService_GreetEveryOneServer, m *member, first *greetpb.GreetEveryOneRequest) error {
+	req := first
+	for {
+		if req == nil {
+			var err error
+			if req, err = stream.Recv(); err != nil {
+				return err
+			}
+		}
+		if room := req.GetRoom(); room != "" && room != m.room {
+			return status.Errorf(codes.InvalidArgument, fmt.Sprintf("Already in room %s, can't switch to %s", m.room, room))
+		}
+
+		l, err := localeFor(stream.Context(), req.GetGreeting())
 		if err != nil {
 			return err
 		}
+		s.hub.broadcast(m.room, &greetpb.GreetEveryOneResponse{
+			Response: l.greet(req.GetGreeting()) + "!",
+			Kind:     greetpb.GreetEveryOneResponse_GREETING,
+			Room:     m.room,
+			Name:     l.name(req.GetGreeting()),
+		})
+		req = nil
+	}
+}
+
+// sendGreetings sends the messages of the room to the stream until done.
+func sendGreetings(stream greetpb.GreetService_GreetEveryOneServer, m *member, done <-chan struct{}) error {
+	for {
+		select {
+		case res := <-m.out:
+			if err := stream.Send(res); err != nil {
+				return err
+			}
+		case <-done:
+			return nil
+		}
 	}
 }
 
-func (s *server) Greet(_ context.Context, req *greetpb.GreetRequest) (*greetpb.GreetResponse, error) {
+func (s *server) Greet(ctx context.Context, req *greetpb.GreetRequest) (*greetpb.GreetResponse, error) {
 	log.Println("Request for Greet was accepted...")
-	result := "Hello " + req.Greeting.FirstName
+	l, err := localeFor(ctx, req.GetGreeting())
+	if err != nil {
+		return nil, err
+	}
+	result := l.greet(req.GetGreeting())
+	if name := req.GetTemplateName(); name != "" {
+		if result, err = s.templates.greet(name, l, req.GetGreeting()); err != nil {
+			return nil, err
+		}
+	}
 	res := &greetpb.GreetResponse{
 		Result: result,
 	}
@@ -48,45 +188,133 @@ func (s *server) Greet(_ context.Context, req *greetpb.GreetRequest) (*greetpb.G
 	return res, nil
 }
 
+// Bounds of the greetings of GreetManyTimes
+const (
+	defaultGreetCount    = 10
+	maxGreetCount        = 100
+	defaultGreetInterval = time.Second
+	minGreetInterval     = 100 * time.Millisecond
+	maxGreetInterval     = time.Minute
+)
+
 func (s *server) GreetManyTimes(req *greetpb.GreetManyTimesRequest, stream greetpb.GreetService_GreetManyTimesServer) error {
 	log.Printf("Request for GreetManyTimes was accepted...\n")
-	firstName := req.GetGreeting().FirstName
-	for i := 1; i <= 10; i++ {
-		result := fmt.Sprintf("Hello %s, this is the greet number %d", firstName, i)
+	l, err := localeFor(stream.Context(), req.GetGreeting())
+	if err != nil {
+		return err
+	}
+
+	count := int(req.GetCount())
+	if count == 0 {
+		count = defaultGreetCount
+	}
+	if count < 0 || count > maxGreetCount {
+		return status.Errorf(codes.InvalidArgument, fmt.Sprintf("Count must be between 1 and %d", maxGreetCount))
+	}
+	interval := defaultGreetInterval
+	if req.GetInterval() != nil {
+		if err := req.GetInterval().CheckValid(); err != nil {
+			return status.Errorf(codes.InvalidArgument, fmt.Sprintf("Invalid interval: %v", err))
+		}
+		interval = req.GetInterval().AsDuration()
+	}
+	if interval < minGreetInterval || interval > maxGreetInterval {
+		return status.Errorf(codes.InvalidArgument, fmt.Sprintf("Interval must be between %v and %v", minGreetInterval, maxGreetInterval))
+	}
+
+	// The trailer tells the client how many greetings it got, whether the
+	// stream completed or not
+	delivered := 0
+	defer func() {
+		stream.SetTrailer(metadata.Pairs("x-delivered-count", strconv.Itoa(delivered)))
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for i := 1; i <= count; i++ {
+		if i > 1 {
+			select {
+			case <-ticker.C:
+			case <-stream.Context().Done():
+				err := stream.Context().Err()
+				log.Printf("GreetManyTimes stopped after %d greetings: %v\n", delivered, err)
+				return status.Errorf(status.FromContextError(err).Code(), fmt.Sprintf("Delivered %d of %d greetings", delivered, count))
+			}
+		}
+
 		res := &greetpb.GreetManyTimesResponse{
-			Result: result,
+			Result: l.greetNumbered(req.GetGreeting(), i),
 		}
-		err := stream.Send(res)
-		time.Sleep(1000 * time.Millisecond)
-		if err != nil {
+		if err := stream.Send(res); err != nil {
 			return err
 		}
+		delivered++
 	}
 
 	return nil
 }
 
+// Limits of LongGreet, so a client can't make the server buffer without
+// bound
+const (
+	maxLongGreetCount  = 1000
+	maxLongGreetResult = 64 << 10
+)
+
 func (s *server) LongGreet(greetServer greetpb.GreetService_LongGreetServer) error {
 	log.Printf("Request for LongGreet was accepted...\n")
-	result := "Hello "
+	// Everyone is greeted in the language of the first greeting
+	var l *locale
+	var names []string
+	size := 0
 
 	for {
 		req, err := greetServer.Recv()
 		if err == io.EOF {
+			if l == nil {
+				if l, err = localeFor(greetServer.Context(), nil); err != nil {
+					return err
+				}
+			}
 			return greetServer.SendAndClose(&greetpb.LongGreetResponse{
-				Result: result,
+				Result: fmt.Sprintf(l.hello, strings.Join(names, " ")),
+				Count:  int32(len(names)),
 			})
 		}
 		if err != nil {
-			log.Fatalf("Error while reading stream: %v", err)
+			// The client went away or the stream broke, only this call fails
+			log.Printf("Error while reading stream: %v\n", err)
+			return err
 		}
 
-		firstName := req.GetGreeting().GetFirstName()
-		result += firstName + " "
+		if l == nil {
+			if l, err = localeFor(greetServer.Context(), req.GetGreeting()); err != nil {
+				return err
+			}
+		}
+		if len(names) == maxLongGreetCount {
+			return status.Errorf(codes.ResourceExhausted, fmt.Sprintf("More than %d greetings", maxLongGreetCount))
+		}
+		name := l.name(req.GetGreeting())
+		if size += len(name) + 1; size > maxLongGreetResult {
+			return status.Errorf(codes.ResourceExhausted, fmt.Sprintf("Greeted names longer than %d bytes", maxLongGreetResult))
+		}
+		names = append(names, name)
 	}
 }
 
 func main() {
+	templatesFile := flag.String("templates-file", "", "JSON file persisting the greeting templates, reloaded when changed; in memory only when empty")
+	flag.Parse()
+
+	templates, err := newTemplateStore(*templatesFile)
+	if err != nil {
+		log.Fatalf("Error loading templates: %v", err)
+	}
+	if *templatesFile != "" {
+		go templates.watch(context.Background(), 2*time.Second)
+	}
+
 	port := "50051"
 	log.Println("Starting server...")
 	li, err := net.Listen("tcp", ":"+port)
@@ -95,7 +323,8 @@ func main() {
 	}
 
 	s := grpc.NewServer()
-	greetpb.RegisterGreetServiceServer(s, &server{})
+	greetpb.RegisterGreetServiceServer(s, &server{hub: newHub(), templates: templates})
+	greetpb.RegisterGreetingTemplateServiceServer(s, &templateServer{store: templates})
 
 	log.Printf("Server listening on port %s", port)
 	if err := s.Serve(li); err != nil {
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurianxdev/grpc-course/greet/greetpb"
+)
+
+// startServer serves the greet service on a local port. The errors returned
+// by the stream handlers are sent to handled.
+func startServer(t *testing.T, srv *server) (greetpb.GreetServiceClient, <-chan error) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+
+	handled := make(chan error, 1)
+	s := grpc.NewServer(grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		handled <- err
+		return err
+	}))
+	greetpb.RegisterGreetServiceServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	// Fixed windows turn off their dynamic growth, so a client not reading
+	// blocks the server quickly
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure(),
+		grpc.WithInitialWindowSize(64<<10), grpc.WithInitialConnWindowSize(64<<10))
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return greetpb.NewGreetServiceClient(conn), handled
+}
+
+func TestGreetEveryOneDisconnectsClientNotReading(t *testing.T) {
+	srv := &server{hub: newHub()}
+	client, handled := startServer(t, srv)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.GreetEveryOne(ctx)
+	if err != nil {
+		t.Fatalf("GreetEveryOne: %v", err)
+	}
+	// Joins, then never calls Recv
+	err = stream.Send(&greetpb.GreetEveryOneRequest{Greeting: &greetpb.Greeting{FirstName: "Slow"}, Room: "flood"})
+	if err != nil {
+		t.Fatalf("sending: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		srv.hub.mu.Lock()
+		joined := len(srv.hub.rooms["flood"]) > 0
+		srv.hub.mu.Unlock()
+		if joined {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("client never joined the room")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Large messages fill the flow control window, blocking the sender
+	flood := &greetpb.GreetEveryOneResponse{
+		Response: strings.Repeat("hello ", 4<<10),
+		Kind:     greetpb.GreetEveryOneResponse_GREETING,
+		Room:     "flood",
+	}
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case err := <-handled:
+			if status.Code(err) != codes.ResourceExhausted {
+				t.Fatalf("handler returned %v, want ResourceExhausted", err)
+			}
+			return
+		case <-timeout:
+			t.Fatal("handler didn't return for a client not reading")
+		default:
+			// Paced so the sender keeps up until it blocks, instead of
+			// the queue filling first
+			srv.hub.broadcast("flood", flood)
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/yurianxdev/grpc-course/greet/greetpb"
+)
+
+// Limits of the templates
+const (
+	maxTemplateText   = 16 << 10
+	maxTemplateResult = 4 << 10
+)
+
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// timesOfDay are the values of time_of_day, checked on upload.
+var timesOfDay = []string{"morning", "afternoon", "evening", "night"}
+
+func timeOfDay(t time.Time) string {
+	switch h := t.Hour(); {
+	case h >= 5 && h < 12:
+		return "morning"
+	case h >= 12 && h < 18:
+		return "afternoon"
+	case h >= 18 && h < 22:
+		return "evening"
+	}
+	return "night"
+}
+
+// templateData is what the templates are executed with.
+func templateData(l *locale, greeting *greetpb.Greeting, now time.Time) map[string]string {
+	return map[string]string{
+		"first_name":  greeting.GetFirstName(),
+		"last_name":   greeting.GetLastName(),
+		"name":        l.name(greeting),
+		"time_of_day": timeOfDay(now),
+		"locale":      l.tag.String(),
+	}
+}
+
+// compileTemplate parses a template and runs it on sample data, so the
+// templates failing for any greeting are rejected on upload.
+func compileTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, fmt.Errorf("empty text")
+	}
+	if len(text) > maxTemplateText {
+		return nil, fmt.Errorf("longer than %d bytes", maxTemplateText)
+	}
+	// A misspelled field fails instead of printing "<no value>"
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := &greetpb.Greeting{FirstName: "Taro", LastName: "Yamada"}
+	for _, tod := range timesOfDay {
+		data := templateData(locales[0], sample, time.Time{})
+		data["time_of_day"] = tod
+		if _, err := executeTemplate(tmpl, data); err != nil {
+			return nil, err
+		}
+	}
+	return tmpl, nil
+}
+
+func executeTemplate(tmpl *template.Template, data map[string]string) (string, error) {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	if b.Len() > maxTemplateResult {
+		return "", fmt.Errorf("greeting longer than %d bytes", maxTemplateResult)
+	}
+	return b.String(), nil
+}
+
+// storedTemplate is a template along with its compiled form.
+type storedTemplate struct {
+	pb   *greetpb.GreetingTemplate
+	tmpl *template.Template
+}
+
+// templateStore holds the templates in memory, so Greet sees the changes
+// right away. When path is set they are persisted to it as JSON, and
+// reloaded when the file is changed by someone else.
+type templateStore struct {
+	mu        sync.RWMutex
+	templates map[string]*storedTemplate
+	path      string
+	// modTime is the modification time of the file as last read or written
+	modTime time.Time
+}
+
+func newTemplateStore(path string) (*templateStore, error) {
+	s := &templateStore{templates: make(map[string]*storedTemplate), path: path}
+	if path == "" {
+		return s, nil
+	}
+	if err := s.load(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return s, nil
+}
+
+// templateFile is the persisted form of a template.
+type templateFile struct {
+	Name      string    `json:"name"`
+	Text      string    `json:"text"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// load replaces the templates with the ones of the file. Nothing changes
+// when one of them is invalid. The lock is held from the read to the swap,
+// so a template saved meanwhile isn't replaced by the older file.
+func (s *templateStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var files []templateFile
+	if err := json.Unmarshal(data, &files); err != nil {
+		return fmt.Errorf("parsing %s: %v", s.path, err)
+	}
+
+	templates := make(map[string]*storedTemplate, len(files))
+	for _, f := range files {
+		if !templateNamePattern.MatchString(f.Name) {
+			return fmt.Errorf("invalid template name %q", f.Name)
+		}
+		tmpl, err := compileTemplate(f.Name, f.Text)
+		if err != nil {
+			return fmt.Errorf("template %s: %v", f.Name, err)
+		}
+		// Templates written by hand may lack the time
+		if f.UpdatedAt.IsZero() {
+			f.UpdatedAt = info.ModTime()
+		}
+		templates[f.Name] = &storedTemplate{
+			pb:   &greetpb.GreetingTemplate{Name: f.Name, Text: f.Text, UpdatedAt: timestamppb.New(f.UpdatedAt)},
+			tmpl: tmpl,
+		}
+	}
+
+	s.templates = templates
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// saveLocked writes the templates through a temporary file, so a crash
+// leaves the previous ones.
+func (s *templateStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	files := make([]templateFile, 0, len(s.templates))
+	for _, t := range s.templates {
+		files = append(files, templateFile{Name: t.pb.GetName(), Text: t.pb.GetText(), UpdatedAt: t.pb.GetUpdatedAt().AsTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// watch reloads the file when its modification time changes, until ctx is
+// done. An invalid file is logged and the current templates kept.
+func (s *templateStore) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		info, err := os.Stat(s.path)
+		if err != nil {
+			continue
+		}
+		s.mu.RLock()
+		changed := !info.ModTime().Equal(s.modTime)
+		s.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := s.load(); err != nil {
+			log.Printf("Error reloading templates: %v\n", err)
+			// Not retried until the file changes again
+			s.mu.Lock()
+			s.modTime = info.ModTime()
+			s.mu.Unlock()
+			continue
+		}
+		log.Printf("Reloaded templates from %s\n", s.path)
+	}
+}
+
+func (s *templateStore) put(name, text string) (*greetpb.GreetingTemplate, error) {
+	if !templateNamePattern.MatchString(name) {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid template name %q", name)
+	}
+	tmpl, err := compileTemplate(name, text)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid template: %v", err)
+	}
+
+	pb := &greetpb.GreetingTemplate{Name: name, Text: text, UpdatedAt: timestamppb.Now()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.templates[name]
+	s.templates[name] = &storedTemplate{pb: pb, tmpl: tmpl}
+	if err := s.saveLocked(); err != nil {
+		s.restoreLocked(name, previous)
+		log.Printf("Error saving templates: %v\n", err)
+		return nil, status.Errorf(codes.Internal, "Error saving templates: %v", err)
+	}
+	return pb, nil
+}
+
+func (s *templateStore) get(name string) (*storedTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.templates[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Template %s not found", name)
+	}
+	return t, nil
+}
+
+func (s *templateStore) list() []*greetpb.GreetingTemplate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*greetpb.GreetingTemplate, 0, len(s.templates))
+	for _, t := range s.templates {
+		list = append(list, t.pb)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].GetName() < list[j].GetName() })
+	return list
+}
+
+func (s *templateStore) delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, ok := s.templates[name]
+	if !ok {
+		return status.Errorf(codes.NotFound, "Template %s not found", name)
+	}
+	delete(s.templates, name)
+	if err := s.saveLocked(); err != nil {
+		s.restoreLocked(name, previous)
+		log.Printf("Error saving templates: %v\n", err)
+		return status.Errorf(codes.Internal, "Error saving templates: %v", err)
+	}
+	return nil
+}
+
+// restoreLocked undoes a change that couldn't be persisted.
+func (s *templateStore) restoreLocked(name string, previous *storedTemplate) {
+	if previous == nil {
+		delete(s.templates, name)
+		return
+	}
+	s.templates[name] = previous
+}
+
+// greet greets with the named template.
+func (s *templateStore) greet(name string, l *locale, greeting *greetpb.Greeting) (string, error) {
+	t, err := s.get(name)
+	if err != nil {
+		return "", err
+	}
+	result, err := executeTemplate(t.tmpl, templateData(l, greeting, time.Now()))
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "Error executing template %s: %v", name, err)
+	}
+	return result, nil
+}
+
+type templateServer struct {
+	store *templateStore
+}
+
+func (s *templateServer) PutTemplate(_ context.Context, req *greetpb.PutTemplateRequest) (*greetpb.PutTemplateResponse, error) {
+	log.Println("Request for PutTemplate was accepted...")
+	t, err := s.store.put(req.GetTemplate().GetName(), req.GetTemplate().GetText())
+	if err != nil {
+		return nil, err
+	}
+	return &greetpb.PutTemplateResponse{Template: t}, nil
+}
+
+func (s *templateServer) GetTemplate(_ context.Context, req *greetpb.GetTemplateRequest) (*greetpb.GetTemplateResponse, error) {
+	log.Println("Request for GetTemplate was accepted...")
+	t, err := s.store.get(req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	return &greetpb.GetTemplateResponse{Template: t.pb}, nil
+}
+
+func (s *templateServer) ListTemplates(context.Context, *greetpb.ListTemplatesRequest) (*greetpb.ListTemplatesResponse, error) {
+	log.Println("Request for ListTemplates was accepted...")
+	return &greetpb.ListTemplatesResponse{Templates: s.store.list()}, nil
+}
+
+func (s *templateServer) DeleteTemplate(_ context.Context, req *greetpb.DeleteTemplateRequest) (*greetpb.DeleteTemplateResponse, error) {
+	log.Println("Request for DeleteTemplate was accepted...")
+	if err := s.store.delete(req.GetName()); err != nil {
+		return nil, err
+	}
+	return &greetpb.DeleteTemplateResponse{Name: req.GetName()}, nil
+}